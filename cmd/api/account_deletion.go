@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/utils"
+	"net/http"
+	"time"
+)
+
+// deletions carried out per sweep
+const accountDeletionBatchSize = 50
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required,max=72"`
+	// "delete" removes the posts and comments, "anonymize" keeps them under
+	// a "deleted user"
+	Mode string `json:"mode" validate:"required,oneof=delete anonymize"`
+}
+
+// requestAccountDeletionHandler godoc
+//
+//	@Summary		Requests the deletion of the current user
+//	@Description	Schedules the deletion of the account after a grace period, during which it can be cancelled. Posts and comments are either deleted or anonymized. All sessions and tokens are revoked
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DeleteAccountPayload	true	"Current password and what happens to the content"
+//	@Success		202		{object}	store.AccountDeletion
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/deletion [post]
+func (app *application) requestAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DeleteAccountPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if err := app.checkCurrentPassword(ctx, user, payload.Password); err != nil {
+		switch err {
+		case errWrongPassword:
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	deletion := &store.AccountDeletion{UserID: user.ID, Mode: payload.Mode}
+
+	if err := app.store.AccountDeletions.Schedule(ctx, deletion, app.config.accountDeletion.gracePeriod); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// signing in again is needed to cancel the deletion
+	if err := app.revokeUserTokens(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	go app.sendAccountDeletion(user.Username, user.Email, deletion.ScheduledAt)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, deletion); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getAccountDeletionHandler godoc
+//
+//	@Summary		Fetches the pending deletion of the current user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.AccountDeletion
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/deletion [get]
+func (app *application) getAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	deletion, err := app.store.AccountDeletions.Get(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, errors.New("no deletion is pending"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, deletion); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// cancelAccountDeletionHandler godoc
+//
+//	@Summary		Cancels the pending deletion of the current user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{string}	string	"Deletion cancelled"
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/deletion [delete]
+func (app *application) cancelAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.store.AccountDeletions.Cancel(r.Context(), getUserFromCtx(r).ID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, errors.New("no deletion is pending"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "deletion cancelled"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) sendAccountDeletion(username, email string, scheduledAt time.Time) {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username    string
+		ScheduledAt string
+	}{
+		Username:    username,
+		ScheduledAt: scheduledAt.UTC().Format("January 2, 2006 15:04 MST"),
+	}
+
+	status, err := app.mailer.Send(mailer.AccountDeletionTemplate, username, email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Error("error sending account deletion email", "email", email, "error", err)
+		return
+	}
+
+	app.logger.Info("Email sent", "status code", status)
+}
+
+// runAccountDeletionSweeper periodically deletes the accounts whose grace
+// period is over.
+func (app *application) runAccountDeletionSweeper(ctx context.Context) {
+	ticker := time.NewTicker(app.config.accountDeletion.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sweepAccountDeletions(ctx)
+		}
+	}
+}
+
+func (app *application) sweepAccountDeletions(ctx context.Context) {
+	deletions, err := app.store.AccountDeletions.Due(ctx, accountDeletionBatchSize)
+	if err != nil {
+		app.logger.Error("error listing due account deletions", "error", err)
+		return
+	}
+
+	for _, deletion := range deletions {
+		if err := app.deleteAccount(ctx, deletion); err != nil {
+			// claimed by another sweep, cancelled or requested again since
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			app.logger.Error("error deleting account", "user_id", deletion.UserID, "error", err)
+		}
+	}
+}
+
+func (app *application) deleteAccount(ctx context.Context, deletion store.AccountDeletion) error {
+	keys, err := app.store.Users.DeleteAccount(ctx, deletion.UserID, deletion.Mode)
+	if err != nil {
+		return fmt.Errorf("deleting user: %w", err)
+	}
+
+	for _, key := range keys {
+		app.deleteBlob(key)
+	}
+
+	if app.config.cache.enabled {
+		app.cacheStorage.Users.Delete(ctx, deletion.UserID)
+	}
+
+	app.logger.Info("deleted account", "user_id", deletion.UserID, "mode", deletion.Mode)
+
+	return nil
+}
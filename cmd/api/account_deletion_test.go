@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"github/hassanharga/go-social/internal/blob"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// dueDeletionStore returns its deletions as due.
+type dueDeletionStore struct {
+	store.MockAccountDeletionStore
+	due []store.AccountDeletion
+}
+
+func (s *dueDeletionStore) Due(ctx context.Context, limit int) ([]store.AccountDeletion, error) {
+	return s.due, nil
+}
+
+// accountStore records the accounts deleted and in which mode, and claims
+// only the users with blob keys.
+type accountStore struct {
+	store.MockUserStore
+	keys    map[int64][]string
+	deleted map[int64]string
+}
+
+func (s *accountStore) DeleteAccount(ctx context.Context, userID int64, mode string) ([]string, error) {
+	keys, ok := s.keys[userID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	s.deleted[userID] = mode
+	return keys, nil
+}
+
+func TestAccountDeletion(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should require the current password", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/me/deletion", strings.NewReader(`{"password":"wrong","mode":"anonymize"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should reject unknown modes", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/me/deletion", strings.NewReader(`{"password":"secret","mode":"archive"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should revoke every token of the user", func(t *testing.T) {
+		revoked := &revokedTokenStore{}
+		app.store.Users = newCredentialStore(t)
+		app.store.Sessions = &sessionStore{}
+		app.store.RevokedTokens = revoked
+		app.store.PersonalTokens = &personalTokenStore{}
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/me/deletion", strings.NewReader(`{"password":"secret","mode":"anonymize"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusAccepted, executeRequest(req, mux).Code)
+
+		if len(app.store.Sessions.(*sessionStore).revoked) != 1 || len(revoked.revokedUsers) != 1 || len(app.store.PersonalTokens.(*personalTokenStore).revokedUsers) != 1 {
+			t.Errorf("expected the sessions, access and personal access tokens of user 1 to be revoked")
+		}
+
+		// the access token is revoked from now on
+		app.store.RevokedTokens = &revokedTokenStore{}
+	})
+
+	t.Run("should report when no deletion is pending", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			req, err := http.NewRequest(method, "/v1/users/me/deletion", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+		}
+	})
+}
+
+func TestSweepAccountDeletions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	ctx := context.Background()
+
+	for _, key := range []string{"avatars/1/avatar.png", "attachments/2/file.pdf"} {
+		if err := app.blobStorage.Put(ctx, key, strings.NewReader("blob"), 4, "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	users := &accountStore{
+		keys: map[int64][]string{
+			1: {"avatars/1/avatar.png"},
+			2: {"attachments/2/file.pdf"},
+		},
+		deleted: make(map[int64]string),
+	}
+	app.store.Users = users
+	// the deletion of user 3 is claimed by another sweep
+	app.store.AccountDeletions = &dueDeletionStore{due: []store.AccountDeletion{
+		{UserID: 1, Mode: store.DeletionModeAnonymize},
+		{UserID: 2, Mode: store.DeletionModeDelete},
+		{UserID: 3, Mode: store.DeletionModeDelete},
+	}}
+
+	app.sweepAccountDeletions(ctx)
+
+	if len(users.deleted) != 2 || users.deleted[1] != store.DeletionModeAnonymize || users.deleted[2] != store.DeletionModeDelete {
+		t.Errorf("expected user 1 anonymized and user 2 deleted, got %v", users.deleted)
+	}
+
+	for _, key := range []string{"avatars/1/avatar.png", "attachments/2/file.pdf"} {
+		if _, err := app.blobStorage.Get(ctx, key); err != blob.ErrNotFound {
+			t.Errorf("expected the blob %s to be deleted, got %v", key, err)
+		}
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"expvar"
 	"fmt"
 	"github/hassanharga/go-social/internal/auth"
+	"github/hassanharga/go-social/internal/blob"
 	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/oidc"
 	"github/hassanharga/go-social/internal/ratelimiter"
 	"github/hassanharga/go-social/internal/store"
 	"github/hassanharga/go-social/internal/store/cache"
+	"github/hassanharga/go-social/internal/totp"
 	"github/hassanharga/go-social/utils"
 	"log/slog"
 	"net/http"
@@ -42,10 +45,21 @@ type mailTrapConfig struct {
 }
 
 type mailConfig struct {
-	expiry    time.Duration
-	fromEmail string
-	sendGrid  sendGridConfig
-	mailTrap  mailTrapConfig
+	expiry              time.Duration
+	passwordResetExpiry time.Duration
+	emailChangeExpiry   time.Duration
+	identityLinkExpiry  time.Duration
+	fromEmail           string
+	sendGrid            sendGridConfig
+	mailTrap            mailTrapConfig
+}
+
+type invitationConfig struct {
+	sweepInterval       time.Duration
+	deleteInactive      bool
+	inactiveGracePeriod time.Duration
+	resendLimit         int
+	resendWindow        time.Duration
 }
 
 type basicConfig struct {
@@ -54,15 +68,68 @@ type basicConfig struct {
 }
 
 type jwtConfig struct {
-	secret string
-	aud    string
-	iss    string
-	exp    time.Duration
+	// asymmetric keys are used instead of the secret when keysDir is set
+	keysDir    string
+	activeKID  string
+	secret     string
+	aud        string
+	iss        string
+	exp        time.Duration
+	refreshExp time.Duration
+	// how often the revocations of expired tokens are purged
+	revocationSweepInterval time.Duration
+}
+
+type mfaConfig struct {
+	encryptionKey string
+	issuer        string
+	tokenExp      time.Duration
 }
 
 type authConfig struct {
-	basic basicConfig
-	jwt   jwtConfig
+	basic   basicConfig
+	jwt     jwtConfig
+	mfa     mfaConfig
+	oidc    []oidc.Config
+	lockout store.LockoutPolicy
+
+	// how often abandoned provider logins and link requests are purged
+	oidcSweepInterval time.Duration
+}
+
+type uploadConfig struct {
+	// "local" or "s3"
+	backend           string
+	localDir          string
+	signingKey        string
+	s3                blob.S3Config
+	urlExpiry         time.Duration
+	maxAvatarSize     int64
+	maxAttachmentSize int64
+	// how often post images are processed when not notified
+	imageInterval  time.Duration
+	imageBatchSize int
+}
+
+type exportConfig struct {
+	// how long an archive can be downloaded
+	expiry        time.Duration
+	sweepInterval time.Duration
+	// how often pending exports are built when not notified
+	interval  time.Duration
+	batchSize int
+}
+
+type accountDeletionConfig struct {
+	// time left to cancel a deletion
+	gracePeriod   time.Duration
+	sweepInterval time.Duration
+}
+
+type postConfig struct {
+	// how often scheduled posts are published, the worst delay of a post
+	publishInterval  time.Duration
+	publishBatchSize int
 }
 
 type cacheConfig struct {
@@ -73,26 +140,38 @@ type cacheConfig struct {
 }
 
 type config struct {
-	addr        string
-	db          dbConfig
-	env         string
-	version     string
-	apiURL      string
-	frontendURL string
-	mail        mailConfig
-	auth        authConfig
-	cache       cacheConfig
-	rateLimiter ratelimiter.Config
+	addr            string
+	db              dbConfig
+	env             string
+	version         string
+	apiURL          string
+	publicURL       string
+	frontendURL     string
+	mail            mailConfig
+	invitations     invitationConfig
+	auth            authConfig
+	cache           cacheConfig
+	uploads         uploadConfig
+	exports         exportConfig
+	accountDeletion accountDeletionConfig
+	posts           postConfig
+	rateLimiter     ratelimiter.Config
 }
 
 type application struct {
 	config
-	store         store.Storage
-	logger        *slog.Logger
-	mailer        mailer.Client
-	authenticator auth.Authenticator
-	cacheStorage  cache.Storage
-	rateLimiter   ratelimiter.Limiter
+	store             store.Storage
+	logger            *slog.Logger
+	mailer            mailer.Client
+	authenticator     auth.Authenticator
+	cacheStorage      cache.Storage
+	rateLimiter       ratelimiter.Limiter
+	activationLimiter ratelimiter.Limiter // throttles activation emails per address
+	totpCipher        *totp.Cipher
+	oidcProviders     map[string]*oidc.Provider
+	blobStorage       blob.Storage
+	imageNotify       chan struct{} // wakes the image processor up
+	exportNotify      chan struct{} // wakes the export processor up
 }
 
 // initialize the server chi and create routes
@@ -123,6 +202,9 @@ func (app *application) mount() http.Handler {
 	// processing should be stopped.
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	// verification keys for other services
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
+
 	r.Route("/v1", func(r chi.Router) {
 
 		// operations
@@ -140,44 +222,135 @@ func (app *application) mount() http.Handler {
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.authTokenMiddleware)
 
-			r.Post("/", app.createPostHandler)
-			// r.Get("/", app.getPostsHandler)
+			r.With(app.requireScope(store.ScopePostsWrite)).Post("/", app.createPostHandler)
 			r.Route("/{id}", func(r chi.Router) {
 				// post middleware
 				r.Use(app.postContextMiddleware)
 
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.checkPostOwnership(store.MODERATOR, app.updatePostHandler))
-				r.Delete("/", app.checkPostOwnership(store.ADMIN, app.deletePostHandler))
-				r.Post("/comments", app.createCommentHandler)
+				r.With(app.requireScope(store.ScopePostsRead)).Get("/", app.getPostHandler)
+				r.With(app.requireScope(store.ScopePostsWrite)).Patch("/", app.checkPostOwnership(store.MODERATOR, app.updatePostHandler))
+				r.With(app.requireScope(store.ScopePostsWrite)).Delete("/", app.checkPostOwnership(store.ADMIN, app.deletePostHandler))
+				r.With(app.requireScope(store.ScopePostsRead)).Get("/revisions", app.checkPostOwnership(store.MODERATOR, app.getPostRevisionsHandler))
+				r.With(app.requireScope(store.ScopePostsRead)).Get("/revisions/{version}/diff", app.checkPostOwnership(store.MODERATOR, app.getPostRevisionDiffHandler))
+				r.With(app.requireScope(store.ScopeCommentsWrite)).Post("/comments", app.createCommentHandler)
 			})
 		})
 		// user routers
 		r.Route("/users", func(r chi.Router) {
 			// activate user
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/email/confirm/{token}", app.confirmEmailChangeHandler)
+			r.Get("/export/{token}", app.downloadDataExportHandler)
+
+			// current user
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+
+				r.Get("/", app.getCurrentUserHandler)
+				r.With(app.denyPersonalTokens).Patch("/", app.updateCurrentUserHandler)
+				r.With(app.denyPersonalTokens).Put("/avatar", app.uploadAvatarHandler)
+				r.With(app.denyPersonalTokens).Post("/export", app.requestDataExportHandler)
+
+				r.Route("/deletion", func(r chi.Router) {
+					r.Use(app.denyPersonalTokens)
+
+					r.Get("/", app.getAccountDeletionHandler)
+					r.Post("/", app.requestAccountDeletionHandler)
+					r.Delete("/", app.cancelAccountDeletionHandler)
+				})
+
+				r.Route("/follow-requests", func(r chi.Router) {
+					r.Use(app.requireScope(store.ScopeFollowsWrite))
+
+					r.Get("/", app.getFollowRequestsHandler)
+					r.Put("/{id}/approve", app.approveFollowRequestHandler)
+					r.Put("/{id}/reject", app.rejectFollowRequestHandler)
+				})
+
+				r.With(app.requireScope(store.ScopeUsersRead)).Get("/suggestions", app.getSuggestionsHandler)
+				r.With(app.requireScope(store.ScopePostsRead)).Get("/drafts", app.getDraftsHandler)
+
+				r.Route("/blocks", func(r chi.Router) {
+					r.Use(app.requireScope(store.ScopeFollowsWrite))
+
+					r.Get("/", app.getBlockedUsersHandler)
+					r.Delete("/{id}", app.unblockUserHandler)
+				})
+
+				r.Route("/mutes", func(r chi.Router) {
+					r.Use(app.requireScope(store.ScopeFollowsWrite))
+
+					r.Get("/", app.getMutedUsersHandler)
+					r.Delete("/{id}", app.unmuteUserHandler)
+				})
+
+				r.Route("/mfa/totp", func(r chi.Router) {
+					r.Use(app.denyPersonalTokens)
+
+					r.Post("/", app.enrollTOTPHandler)
+					r.Post("/verify", app.verifyTOTPHandler)
+					r.Delete("/", app.disableTOTPHandler)
+				})
+
+				r.Route("/tokens", func(r chi.Router) {
+					r.Use(app.denyPersonalTokens)
+
+					r.Post("/", app.createPersonalTokenHandler)
+					r.Get("/", app.listPersonalTokensHandler)
+					r.Delete("/{tokenID}", app.deletePersonalTokenHandler)
+				})
+			})
 
 			r.Route("/{id}", func(r chi.Router) {
 				// user middleware
 				r.Use(app.authTokenMiddleware)
 
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireScope(store.ScopeUsersRead)).Get("/", app.getUserHandler)
+				r.With(app.requireScope(store.ScopeFollowsRead)).Get("/followers", app.getFollowersHandler)
+				r.With(app.requireScope(store.ScopeFollowsRead)).Get("/following", app.getFollowingHandler)
+				r.With(app.requireScope(store.ScopePostsRead)).Get("/posts", app.getUserPostsHandler)
+				r.With(app.requireScope(store.ScopeFollowsWrite)).Put("/follow", app.followUserHandler)
+				r.With(app.requireScope(store.ScopeFollowsWrite)).Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireScope(store.ScopeFollowsWrite)).Put("/block", app.blockUserHandler)
+				r.With(app.requireScope(store.ScopeFollowsWrite)).Put("/mute", app.muteUserHandler)
+				r.With(app.denyPersonalTokens).Post("/tokens/revoke", app.revokeUserTokensHandler)
+				r.With(app.denyPersonalTokens).Post("/unlock", app.unlockUserHandler)
 			})
 
 			// user feed
 			r.Group(func(r chi.Router) {
 				r.Use(app.authTokenMiddleware)
-				r.Get("/feed", app.getUserFeedHandler)
+				r.With(app.requireScope(store.ScopeFeedRead)).Get("/feed", app.getUserFeedHandler)
+				r.With(app.requireScope(store.ScopeUsersRead)).Get("/search", app.searchUsersHandler)
 			})
 
 		})
 
+		// uploads
+		r.Route("/uploads", func(r chi.Router) {
+			r.With(app.authTokenMiddleware, app.requireScope(store.ScopePostsWrite)).Post("/", app.uploadAttachmentHandler)
+			r.With(app.authTokenMiddleware, app.requireScope(store.ScopeUsersRead)).Get("/{uploadID}", app.getUploadHandler)
+		})
+
+		// files of the local blob storage, served from signed URLs
+		r.Get("/files/*", app.serveFileHandler)
+
 		// auth routers
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/register", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/token/mfa", app.createTokenMFAHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.Post("/logout", app.logoutHandler)
+			r.With(app.authTokenMiddleware, app.denyPersonalTokens).Post("/revoke", app.revokeTokenHandler)
+			r.Post("/password/forgot", app.forgotPasswordHandler)
+			r.Post("/password/reset", app.resetPasswordHandler)
+			r.Post("/activation/resend", app.resendActivationHandler)
+
+			// external identity providers
+			r.Get("/oidc/{provider}/login", app.oidcLoginHandler)
+			r.Get("/oidc/{provider}/callback", app.oidcCallbackHandler)
+			r.Put("/oidc/link/{token}", app.confirmIdentityLinkHandler)
 		})
 	})
 
@@ -205,6 +378,19 @@ func (app *application) run() error {
 
 	shutdown := make(chan error)
 
+	// background jobs stop together with the server
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go app.runInvitationSweeper(ctx)
+	go app.runRevokedTokenSweeper(ctx)
+	go app.runOIDCSweeper(ctx)
+	go app.runImageProcessor(ctx)
+	go app.runExportProcessor(ctx)
+	go app.runExportSweeper(ctx)
+	go app.runAccountDeletionSweeper(ctx)
+	go app.runPostScheduler(ctx)
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
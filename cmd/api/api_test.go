@@ -15,6 +15,12 @@ func TestRateLimiterMiddleware(t *testing.T) {
 			TimeFrame:            time.Second * 5,
 			Enabled:              true,
 		},
+		auth: authConfig{
+			basic: basicConfig{
+				user:     "admin",
+				password: "adminpassword",
+			},
+		},
 		addr: ":3000",
 	}
 
@@ -33,6 +39,7 @@ func TestRateLimiterMiddleware(t *testing.T) {
 		}
 
 		req.Header.Set("X-Forwarded-For", mockIP)
+		req.SetBasicAuth(cfg.auth.basic.user, cfg.auth.basic.password)
 
 		resp, err := client.Do(req)
 		if err != nil {
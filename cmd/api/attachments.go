@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/store"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// multipart fields of a post created with attachments
+	postPayloadField    = "payload"
+	postAttachmentField = "attachments"
+
+	maxPostAttachments = 4
+)
+
+var errTooManyAttachments = fmt.Errorf("at most %d attachments can be added to a post", maxPostAttachments)
+
+type AttachmentPayload struct {
+	AltText string `json:"alt_text" validate:"max=500"`
+}
+
+// isMultipart reports whether the request body is a multipart form.
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// readPostForm reads a post created as a multipart form: its JSON payload in
+// the "payload" field and its files in the "attachments" fields.
+func readPostForm(w http.ResponseWriter, r *http.Request, payload *CreatePostPayload, maxSize int64) ([][]byte, error) {
+	// leave room for the payload, multipart headers and boundaries
+	r.Body = http.MaxBytesReader(w, r.Body, maxPostAttachments*maxSize+1<<20)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	var files [][]byte
+	var hasPayload bool
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, tooLargeOr(err)
+		}
+
+		switch part.FormName() {
+		case postPayloadField:
+			decoder := json.NewDecoder(io.LimitReader(part, 1<<20))
+			decoder.DisallowUnknownFields()
+
+			err = decoder.Decode(payload)
+			hasPayload = true
+		case postAttachmentField:
+			if len(files) == maxPostAttachments {
+				err = errTooManyAttachments
+				break
+			}
+
+			var data []byte
+			data, err = io.ReadAll(io.LimitReader(part, maxSize+1))
+			switch {
+			case err != nil:
+				err = tooLargeOr(err)
+			case int64(len(data)) > maxSize:
+				err = errFileTooLarge
+			case len(data) == 0:
+				err = errMissingFile
+			default:
+				files = append(files, data)
+			}
+		}
+
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasPayload {
+		return nil, fmt.Errorf("missing post, send it as JSON in the %q field", postPayloadField)
+	}
+
+	if len(payload.Attachments) > len(files) {
+		return nil, errors.New("more attachment details than files")
+	}
+
+	return files, nil
+}
+
+// storeAttachments checks the content type of the files and saves them to
+// the blob storage. Already stored files are deleted when one fails.
+func (app *application) storeAttachments(ctx context.Context, userID int64, files [][]byte, details []AttachmentPayload) ([]store.Attachment, error) {
+	attachments := make([]store.Attachment, 0, len(files))
+
+	for i, data := range files {
+		// the declared content type is not trusted
+		contentType := http.DetectContentType(data)
+		ext, ok := attachmentContentTypes[contentType]
+		if !ok {
+			app.deleteAttachmentBlobs(attachments)
+			return nil, fmt.Errorf("%w: %s", errUnsupportedFile, contentType)
+		}
+
+		a := store.Attachment{
+			Type:        attachmentType(contentType),
+			Key:         fmt.Sprintf("attachments/%d/%s%s", userID, uuid.New(), ext),
+			ContentType: contentType,
+			Size:        int64(len(data)),
+		}
+
+		if i < len(details) {
+			a.AltText = strings.TrimSpace(details[i].AltText)
+		}
+
+		if a.Type == store.AttachmentTypeImage {
+			if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+				a.Width, a.Height = config.Width, config.Height
+			}
+		}
+
+		if err := app.blobStorage.Put(ctx, a.Key, bytes.NewReader(data), a.Size, contentType); err != nil {
+			app.deleteAttachmentBlobs(attachments)
+			return nil, err
+		}
+
+		attachments = append(attachments, a)
+	}
+
+	return attachments, nil
+}
+
+func attachmentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return store.AttachmentTypeImage
+	case strings.HasPrefix(contentType, "video/"):
+		return store.AttachmentTypeVideo
+	default:
+		return store.AttachmentTypeFile
+	}
+}
+
+func (app *application) deleteAttachmentBlobs(attachments []store.Attachment) {
+	for _, a := range attachments {
+		app.deleteBlob(a.Key)
+	}
+}
+
+// loadAttachments sets the attachments of the posts, with signed URLs.
+func (app *application) loadAttachments(ctx context.Context, posts ...*store.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	attachments, err := app.store.Attachments.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Attachments = attachments[post.ID]
+		if post.Attachments == nil {
+			post.Attachments = []store.Attachment{}
+		}
+
+		if err := app.signAttachmentURLs(ctx, post.Attachments); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (app *application) signAttachmentURLs(ctx context.Context, attachments []store.Attachment) error {
+	for i := range attachments {
+		signed, err := app.blobStorage.SignedURL(ctx, attachments[i].Key, app.config.uploads.urlExpiry)
+		if err != nil {
+			return err
+		}
+		attachments[i].URL = signed
+	}
+
+	return nil
+}
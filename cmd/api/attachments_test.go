@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newPostFormRequest(t *testing.T, payload string, files ...[]byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	if err := writer.WriteField(postPayloadField, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range files {
+		part, err := writer.CreateFormFile(postAttachmentField, "file.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	writer.Close()
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/posts", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return req
+}
+
+func TestCreatePostWithAttachments(t *testing.T) {
+	app := newTestApplication(t, config{
+		uploads: uploadConfig{
+			urlExpiry:         time.Minute,
+			maxAttachmentSize: 1 << 10,
+		},
+	})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewNRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should store the files with the post", func(t *testing.T) {
+		req := newPostFormRequest(t, `{"title":"hello","content":"world","attachments":[{"alt_text":"a square"}]}`, img.Bytes())
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var res struct {
+			Data struct {
+				Attachments []struct {
+					Type    string `json:"type"`
+					Width   int    `json:"width"`
+					Height  int    `json:"height"`
+					AltText string `json:"alt_text"`
+					URL     string `json:"url"`
+				} `json:"attachments"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Data.Attachments) != 1 {
+			t.Fatalf("expected one attachment, got %d", len(res.Data.Attachments))
+		}
+
+		a := res.Data.Attachments[0]
+		if a.Type != "image" || a.Width != 3 || a.Height != 2 || a.AltText != "a square" || a.URL == "" {
+			t.Errorf("unexpected attachment %+v", a)
+		}
+	})
+
+	t.Run("should limit the number of files", func(t *testing.T) {
+		files := make([][]byte, maxPostAttachments+1)
+		for i := range files {
+			files[i] = img.Bytes()
+		}
+
+		req := newPostFormRequest(t, `{"title":"hello","content":"world"}`, files...)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should reject files over the size limit", func(t *testing.T) {
+		req := newPostFormRequest(t, `{"title":"hello","content":"world"}`, append(pngHeader, make([]byte, 2<<10)...))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusRequestEntityTooLarge, executeRequest(req, mux).Code)
+	})
+}
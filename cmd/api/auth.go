@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"github/hassanharga/go-social/internal/auth"
 	"github/hassanharga/go-social/internal/mailer"
 	"github/hassanharga/go-social/internal/store"
 	"github/hassanharga/go-social/utils"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -89,19 +92,8 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		User:  user,
 		Token: plainToken,
 	}
-	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
-
-	isProdEnv := app.config.env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
-	}
-
 	// send mail
-	status, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
+	status, err := app.sendActivationEmail(user, plainToken)
 	if err != nil {
 		app.logger.Error("error sending welcome email", "error", err)
 
@@ -134,7 +126,7 @@ type CreateUserTokenPayload struct {
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreateUserTokenPayload	true	"User credentials"
-//	@Success		200		{string}	string					"Token"
+//	@Success		200		{object}	TokenPair				"Token pair, or an MFAChallenge when two-factor authentication is enabled"
 //	@Failure		400		{object}	error
 //	@Failure		401		{object}	error
 //	@Failure		500		{object}	error
@@ -151,25 +143,246 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	ctx := r.Context()
+
+	// unknown emails go through the same lookups as wrong passwords, and
+	// get the same answer as locked accounts, so neither reveals an account
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	known := err == nil
+	switch err {
+	case nil:
+	case store.ErrNotFound:
+		user = &store.User{}
+	default:
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	lockout, err := app.store.Lockouts.Get(ctx, user.ID)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the password is compared even for locked accounts to keep the timing
+	passwordErr := errInvalidCredentials
+	if known {
+		passwordErr = user.Password.Compare(payload.Password)
+	} else {
+		compareDummyPassword(payload.Password)
+	}
+
+	if passwordErr != nil {
+		if _, err := app.recordLoginFailure(ctx, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.unauthorizedError(w, r, passwordErr)
+		return
+	}
+
+	if lockout != nil && lockout.IsLocked(time.Now()) {
+		app.unauthorizedError(w, r, errAccountLocked)
+		return
+	}
+
+	app.completeLogin(w, r, user.ID)
+}
+
+// completeLogin answers a verified first factor with a token pair, or with a
+// challenge when the account has two-factor authentication. Failed logins
+// are only forgotten once the user is fully signed in.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, userID int64) {
+	ctx := r.Context()
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, userID)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if mfa != nil && mfa.Enabled {
+		mfaToken, err := app.generateMFAToken(userID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		challenge := MFAChallenge{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		}
+
+		if err := app.jsonResponse(w, http.StatusOK, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Lockouts.Reset(ctx, userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens, err := app.issueTokens(ctx, userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=255"`
+}
+
+// refreshTokenHandler godoc
+//
+//	@Summary		Refreshes a token
+//	@Description	Exchanges a refresh token for a new access and refresh token pair
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@Success		200		{object}	TokenPair
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	refreshToken := uuid.New().String()
+
+	session, err := app.store.Sessions.Rotate(ctx, payload.RefreshToken, refreshToken, app.config.auth.jwt.refreshExp)
 	if err != nil {
 		switch err {
 		case store.ErrNotFound:
 			app.unauthorizedError(w, r, err)
+		case store.ErrTokenReused:
+			app.logger.Warn("refresh token reused, session revoked", "error", err)
+			app.unauthorizedError(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
 
-	// check if password is correct or not
-	if err := user.Password.Compare(payload.Password); err != nil {
-		app.unauthorizedError(w, r, err)
+	// make sure the user was not deactivated since the session started
+	if _, err := app.getUser(ctx, session.UserID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
+	accessToken, err := app.generateAccessToken(session.UserID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens := TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(app.config.auth.jwt.exp.Seconds()),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// logoutHandler godoc
+//
+//	@Summary		Logs out a user
+//	@Description	Revokes the session the refresh token belongs to
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@Success		200		{string}	string				"Session revoked"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/logout [post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Sessions.Revoke(r.Context(), payload.RefreshToken); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "logged out"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// issueTokens starts a new session for the user and returns a short-lived
+// access token together with the session refresh token.
+func (app *application) issueTokens(ctx context.Context, userID int64) (*TokenPair, error) {
+	accessToken, err := app.generateAccessToken(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := uuid.New().String()
+
+	session := &store.Session{UserID: userID}
+	if err := app.store.Sessions.Create(ctx, session, refreshToken, app.config.auth.jwt.refreshExp); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(app.config.auth.jwt.exp.Seconds()),
+	}, nil
+}
+
+func (app *application) generateAccessToken(userID int64) (string, error) {
 	claims := jwt.MapClaims{
-		"sub": user.ID,
+		"sub": userID,
+		"jti": uuid.New().String(),
 		"exp": time.Now().Add(app.config.auth.jwt.exp).Unix(),
 		"iat": time.Now().Unix(),
 		"nbf": time.Now().Unix(),
@@ -177,15 +390,22 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		"aud": app.config.auth.jwt.aud,
 	}
 
-	token, err := app.authenticator.GenerateToken(claims)
-	if err != nil {
-		app.internalServerError(w, r, err)
-		return
-	}
+	return app.authenticator.GenerateToken(claims)
+}
 
-	if err := app.jsonResponse(w, http.StatusOK, token); err != nil {
-		app.internalServerError(w, r, err)
+func (app *application) sendActivationEmail(user *store.User, plainToken string) (int, error) {
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: activationURL,
 	}
+
+	return app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
 }
 
 // ActivateUser godoc
@@ -222,3 +442,211 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.internalServerError(w, r, err)
 	}
 }
+
+type tokenClaims struct {
+	userID    int64
+	jti       string
+	tokenType string
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+func parseTokenClaims(token *jwt.Token) (*tokenClaims, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token subject")
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return nil, fmt.Errorf("token is missing the jti claim")
+	}
+
+	tc := &tokenClaims{
+		userID: userID,
+		jti:    jti,
+	}
+
+	// access tokens carry no type, anything else is for a dedicated endpoint
+	if typ, ok := claims["typ"].(string); ok {
+		tc.tokenType = typ
+	}
+
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		tc.issuedAt = iat.Time
+	}
+
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		tc.expiresAt = exp.Time
+	}
+
+	return tc, nil
+}
+
+type RevokeTokenPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// revokeTokenHandler godoc
+//
+//	@Summary		Revokes a token
+//	@Description	Revokes a single access token. Users can revoke their own tokens, admins any token
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RevokeTokenPayload	true	"Access token"
+//	@Success		200		{string}	string				"Token revoked"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/auth/revoke [post]
+func (app *application) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RevokeTokenPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(payload.Token)
+	if err != nil {
+		app.badRequestError(w, r, fmt.Errorf("invalid token"))
+		return
+	}
+
+	claims, err := parseTokenClaims(jwtToken)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+
+	if claims.userID != user.ID {
+		allowed, err := app.checkRolePrecedence(ctx, user, store.ADMIN)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenError(w, r)
+			return
+		}
+	}
+
+	if err := app.revokeToken(ctx, claims); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "token revoked"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revokeUserTokensHandler godoc
+//
+//	@Summary		Revokes all tokens of a user
+//	@Description	Revokes every access token, session and personal access token of a user. Users can revoke their own tokens, admins anyone's
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		200	{string}	string	"Tokens revoked"
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/tokens/revoke [post]
+func (app *application) revokeUserTokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromCtx(r)
+
+	if userID != user.ID {
+		allowed, err := app.checkRolePrecedence(ctx, user, store.ADMIN)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenError(w, r)
+			return
+		}
+	}
+
+	if err := app.revokeUserTokens(ctx, userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "tokens revoked"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// runRevokedTokenSweeper periodically purges the revocations of tokens that
+// have expired since. Redis expires them on its own.
+func (app *application) runRevokedTokenSweeper(ctx context.Context) {
+	ticker := time.NewTicker(app.config.auth.jwt.revocationSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sweepRevokedTokens(ctx)
+		}
+	}
+}
+
+func (app *application) sweepRevokedTokens(ctx context.Context) {
+	purged, err := app.store.RevokedTokens.DeleteExpired(ctx)
+	if err != nil {
+		app.logger.Error("error purging expired token revocations", "error", err)
+		return
+	}
+
+	app.logger.Info("purged expired token revocations", "count", purged)
+}
+
+// jwksHandler godoc
+//
+//	@Summary		Publishes the token verification keys
+//	@Description	JSON Web Key Set with the public keys tokens are signed with
+//	@Tags			auth
+//	@Produce		json
+//	@Success		200	{object}	auth.JWKSet
+//	@Failure		404	{object}	error
+//	@Router			/.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	publisher, ok := app.authenticator.(auth.KeyPublisher)
+	if !ok {
+		app.notFoundError(w, r, fmt.Errorf("tokens are not signed with asymmetric keys"))
+		return
+	}
+
+	// served as a bare key set, verifiers do not expect the data envelope
+	if err := utils.WriteJson(w, http.StatusOK, publisher.JWKS()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
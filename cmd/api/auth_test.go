@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRefreshToken(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	t.Run("should reject a missing refresh token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/auth/refresh", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should rotate the refresh token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/auth/refresh", strings.NewReader(`{"refresh_token":"old-token"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data TokenPair `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if body.Data.AccessToken == "" {
+			t.Error("expected an access token")
+		}
+
+		if body.Data.RefreshToken == "" || body.Data.RefreshToken == "old-token" {
+			t.Errorf("expected a new refresh token, got %q", body.Data.RefreshToken)
+		}
+	})
+}
+
+// roleStore has the levels of the default roles.
+type roleStore struct{}
+
+func (s *roleStore) GetByName(ctx context.Context, slug store.RoleKeys) (*store.Role, error) {
+	levels := map[store.RoleKeys]int{store.USER: 1, store.MODERATOR: 2, store.ADMIN: 3}
+	return &store.Role{Name: string(slug), Level: levels[slug]}, nil
+}
+
+func TestCreateToken(t *testing.T) {
+	app := newTestApplication(t, config{auth: authConfig{
+		mfa:     mfaConfig{tokenExp: time.Minute * 5},
+		lockout: newLockoutPolicy(),
+	}})
+	mux := app.mount()
+
+	mfa := &mfaStore{}
+	lockouts := newLockoutStore()
+	app.store.Users = newCredentialStore(t)
+	app.store.MFA = mfa
+	app.store.Lockouts = lockouts
+
+	login := func(t *testing.T, email, password string) *httptest.ResponseRecorder {
+		body := `{"email":"` + email + `","password":"` + password + `"}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/auth/token", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should reject a wrong password", func(t *testing.T) {
+		checkResponseCode(t, http.StatusUnauthorized, login(t, "test@example.com", "wrong-password").Code)
+	})
+
+	t.Run("should lock the account after too many failed logins", func(t *testing.T) {
+		lockouts.Reset(context.Background(), 1)
+
+		for i := 0; i < app.config.auth.lockout.MaxAttempts; i++ {
+			checkResponseCode(t, http.StatusUnauthorized, login(t, "test@example.com", "wrong-password").Code)
+		}
+
+		lockout, ok := lockouts.lockouts[1]
+		if !ok || !lockout.IsLocked(time.Now()) {
+			t.Fatalf("expected user 1 to be locked, got %+v", lockout)
+		}
+
+		// even the right password is refused until the lock ends
+		checkResponseCode(t, http.StatusUnauthorized, login(t, "test@example.com", "secret").Code)
+
+		// the notification is sent in the background
+		deadline := time.Now().Add(time.Second)
+		for len(app.mailer.(*mailer.MockMailer).Sent()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		sent := app.mailer.(*mailer.MockMailer).Sent()
+		if len(sent) != 1 || sent[0].Template != mailer.AccountLockedTemplate || sent[0].Email != "test@example.com" {
+			t.Errorf("expected an account locked email, got %+v", sent)
+		}
+	})
+
+	t.Run("should answer locked accounts like unknown emails", func(t *testing.T) {
+		locked := login(t, "test@example.com", "secret")
+		unknown := login(t, "unknown@example.com", "secret")
+
+		if locked.Code != unknown.Code || locked.Body.String() != unknown.Body.String() {
+			t.Errorf("expected the same answer, got %d %q and %d %q", locked.Code, locked.Body, unknown.Code, unknown.Body)
+		}
+	})
+
+	t.Run("should reset the failed logins after a successful login", func(t *testing.T) {
+		lockouts.Reset(context.Background(), 1)
+
+		checkResponseCode(t, http.StatusUnauthorized, login(t, "test@example.com", "wrong-password").Code)
+		checkResponseCode(t, http.StatusOK, login(t, "test@example.com", "secret").Code)
+
+		if lockout, ok := lockouts.lockouts[1]; ok {
+			t.Errorf("expected the failed logins to be reset, got %+v", lockout)
+		}
+	})
+
+	t.Run("should keep the failed logins until the MFA step succeeds", func(t *testing.T) {
+		mfa.mfa = &store.UserMFA{UserID: 1, Enabled: true}
+		defer func() { mfa.mfa = nil }()
+
+		checkResponseCode(t, http.StatusUnauthorized, login(t, "test@example.com", "wrong-password").Code)
+		checkResponseCode(t, http.StatusOK, login(t, "test@example.com", "secret").Code)
+
+		if lockout, ok := lockouts.lockouts[1]; !ok || lockout.FailedAttempts != 1 {
+			t.Errorf("expected the failed login to be kept, got %+v", lockout)
+		}
+	})
+}
+
+func TestUnlockUser(t *testing.T) {
+	app := newTestApplication(t, config{auth: authConfig{lockout: newLockoutPolicy()}})
+	mux := app.mount()
+
+	users := newCredentialStore(t)
+	lockouts := newLockoutStore()
+	app.store.Users = users
+	app.store.Roles = &roleStore{}
+	app.store.Lockouts = lockouts
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock := func(t *testing.T, userID string) int {
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/"+userID+"/unlock", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	lockedUntil := time.Now().Add(time.Hour)
+	lockouts.lockouts[1] = &store.AccountLockout{UserID: 1, Lockouts: 1, LockedUntil: &lockedUntil}
+
+	t.Run("should only let admins unlock accounts", func(t *testing.T) {
+		users.user.Role = store.Role{Name: "moderator", Level: 2}
+
+		checkResponseCode(t, http.StatusForbidden, unlock(t, "1"))
+
+		if _, ok := lockouts.lockouts[1]; !ok {
+			t.Error("expected the account to stay locked")
+		}
+	})
+
+	t.Run("should unlock the account", func(t *testing.T) {
+		users.user.Role = store.Role{Name: "admin", Level: 3}
+
+		checkResponseCode(t, http.StatusOK, unlock(t, "1"))
+
+		if lockout, ok := lockouts.lockouts[1]; ok {
+			t.Errorf("expected the lock to be cleared, got %+v", lockout)
+		}
+	})
+
+	t.Run("should return not found for unknown users", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, unlock(t, "2"))
+	})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// blockUserHandler godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Blocks a user by ID. Follows and follow requests between both users are removed, and they can no longer follow each other, see each other's posts and comments or comment on each other's posts
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error	"Blocking yourself"
+//	@Failure		404	{object}	error	"User not found"
+//	@Failure		409	{object}	error	"User already blocked"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if err := app.store.Blocks.Block(ctx, user.ID, blockedID); err != nil {
+		switch err {
+		case store.ErrSelfBlock:
+			app.badRequestError(w, r, err)
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		case store.ErrConflict:
+			app.conflictError(w, r, errors.New("user already blocked"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the follows between both users are gone
+	app.invalidateFollowCounts(ctx, user.ID, blockedID)
+	app.invalidateSuggestions(ctx, user.ID, blockedID)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getBlockedUsersHandler godoc
+//
+//	@Summary		Lists the users blocked by the current user
+//	@Description	Lists the blocked users, most recently blocked first. Pass the returned next_cursor to fetch the next page
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Page size, up to 100"
+//	@Param			cursor	query		string	false	"Cursor of the next page"
+//	@Success		200		{object}	store.RestrictedUserPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks [get]
+func (app *application) getBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	app.restrictedList(w, r, app.store.Blocks.GetBlocked)
+}
+
+// unblockUserHandler godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Unblocks a user. Follows removed by the block are not restored
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error	"User not blocked"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks/{id} [delete]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.unrestrict(w, r, app.store.Blocks.Unblock, errors.New("user not blocked"))
+}
+
+// muteUserHandler godoc
+//
+//	@Summary		Mutes a user
+//	@Description	Hides the posts of a user from the feed of the current user. The muted user is not told and nothing else changes
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error	"Muting yourself"
+//	@Failure		404	{object}	error	"User not found"
+//	@Failure		409	{object}	error	"User already muted"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	mutedID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if err := app.store.Mutes.Mute(ctx, user.ID, mutedID); err != nil {
+		switch err {
+		case store.ErrSelfMute:
+			app.badRequestError(w, r, err)
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		case store.ErrConflict:
+			app.conflictError(w, r, errors.New("user already muted"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateSuggestions(ctx, user.ID)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMutedUsersHandler godoc
+//
+//	@Summary		Lists the users muted by the current user
+//	@Description	Lists the muted users, most recently muted first. Pass the returned next_cursor to fetch the next page
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Page size, up to 100"
+//	@Param			cursor	query		string	false	"Cursor of the next page"
+//	@Success		200		{object}	store.RestrictedUserPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mutes [get]
+func (app *application) getMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	app.restrictedList(w, r, app.store.Mutes.GetMuted)
+}
+
+// unmuteUserHandler godoc
+//
+//	@Summary		Unmutes a user
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error	"User not muted"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mutes/{id} [delete]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.unrestrict(w, r, app.store.Mutes.Unmute, errors.New("user not muted"))
+}
+
+type restrictedListFunc func(ctx context.Context, userID int64, fq store.PaginatedFollowQuery) (*store.RestrictedUserPage, error)
+
+func (app *application) restrictedList(w http.ResponseWriter, r *http.Request, list restrictedListFunc) {
+	fq := store.PaginatedFollowQuery{
+		Limit: 20,
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	page, err := list(r.Context(), getUserFromCtx(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) unrestrict(w http.ResponseWriter, r *http.Request, undo func(ctx context.Context, userID, otherID int64) error, notFound error) {
+	otherID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if err := undo(ctx, user.ID, otherID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, notFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the user can be suggested again
+	app.invalidateSuggestions(ctx, user.ID)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
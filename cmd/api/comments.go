@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"github/hassanharga/go-social/internal/store"
 	"github/hassanharga/go-social/utils"
 	"net/http"
@@ -25,15 +26,34 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// unpublished posts can't be commented on
+	if post.Status != store.PostStatusPublished {
+		app.notFoundError(w, r, errors.New("post not found"))
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	// posts hidden from the user, by a private account or a block, can't be
+	// commented on either
+	visible, err := app.store.Followers.CanSeePosts(ctx, post.UserID, user.ID)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.notFoundError(w, r, errors.New("post not found"))
+		return
+	}
+
 	comment := &store.Comment{
 		Content: payload.Content,
 		PostID:  post.ID,
-		// TODO: Change after auth
-		UserID: 1,
+		UserID:  user.ID,
 	}
 
-	ctx := r.Context()
-
 	if err := app.store.Comments.Create(ctx, comment); err != nil {
 		app.internalServerError(w, r, err)
 		return
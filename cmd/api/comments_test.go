@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// hiddenPostsStore hides the posts of every user.
+type hiddenPostsStore struct {
+	store.MockFollowerStore
+}
+
+func (s *hiddenPostsStore) CanSeePosts(ctx context.Context, userID, viewerID int64) (bool, error) {
+	return false, nil
+}
+
+func TestCreateComment(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not comment on hidden posts", func(t *testing.T) {
+		app.store.Followers = &hiddenPostsStore{}
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts/1/comments", strings.NewReader(`{"content":"hello"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+	})
+}
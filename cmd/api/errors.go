@@ -29,7 +29,7 @@ func (app *application) conflictError(w http.ResponseWriter, r *http.Request, er
 }
 
 func (app *application) forbiddenError(w http.ResponseWriter, r *http.Request) {
-	app.logger.Warn("forbidden", "method", r.Method, "path", r.URL.Path, "error")
+	app.logger.Warn("forbidden", "method", r.Method, "path", r.URL.Path)
 
 	utils.WriteJsonError(w, http.StatusForbidden, "forbidden")
 }
@@ -55,3 +55,9 @@ func (app *application) rateLimitExceededError(w http.ResponseWriter, r *http.Re
 
 	utils.WriteJsonError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
 }
+
+func (app *application) payloadTooLargeError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warn("payload too large", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	utils.WriteJsonError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/blob"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// exports claimed for longer, by a worker that died, are claimed again
+	exportStaleAfter = time.Minute * 30
+	// an export is failed once it was claimed more often without completing
+	maxExportAttempts = 3
+)
+
+// requestDataExportHandler godoc
+//
+//	@Summary		Requests a data export
+//	@Description	Prepares a ZIP archive of the profile, posts, comments, followers, following and uploaded media of the current user in the background, and emails a download link once it is ready
+//	@Tags			users
+//	@Produce		json
+//	@Success		202	{object}	store.DataExport
+//	@Failure		401	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/export [post]
+func (app *application) requestDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	export := &store.DataExport{UserID: getUserFromCtx(r).ID}
+
+	if err := app.store.DataExports.Create(r.Context(), export, app.config.exports.expiry); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictError(w, r, errors.New("an export is already being prepared"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.notifyExportProcessor()
+
+	if err := app.jsonResponse(w, http.StatusAccepted, export); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// downloadDataExportHandler godoc
+//
+//	@Summary		Downloads a data export
+//	@Description	Redirects to a short-lived signed URL of the archive, using the token sent by email
+//	@Tags			users
+//	@Param			token	path	string	true	"Download token"
+//	@Success		302
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/users/export/{token} [get]
+func (app *application) downloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	export, err := app.store.DataExports.GetByToken(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	signedURL, err := app.blobStorage.SignedURL(ctx, export.Key, app.config.uploads.urlExpiry)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, signedURL, http.StatusFound)
+}
+
+// notifyExportProcessor wakes the export processor up without waiting for
+// its next tick.
+func (app *application) notifyExportProcessor() {
+	select {
+	case app.exportNotify <- struct{}{}:
+	default:
+	}
+}
+
+// runExportProcessor builds the requested exports in the background, on
+// every tick and whenever an export is requested.
+func (app *application) runExportProcessor(ctx context.Context) {
+	ticker := time.NewTicker(app.config.exports.interval)
+	defer ticker.Stop()
+
+	for {
+		app.processDataExports(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-app.exportNotify:
+		}
+	}
+}
+
+// processDataExports works through the pending exports in batches until none
+// are left.
+func (app *application) processDataExports(ctx context.Context) {
+	for ctx.Err() == nil {
+		exports, err := app.store.DataExports.ClaimPending(ctx, app.config.exports.batchSize, exportStaleAfter)
+		if err != nil {
+			app.logger.Error("error claiming data exports", "error", err)
+			return
+		}
+
+		if len(exports) == 0 {
+			return
+		}
+
+		for i := range exports {
+			app.buildDataExport(ctx, &exports[i])
+		}
+	}
+}
+
+// buildDataExport assembles the archive of an export, stores it and emails
+// its download link.
+func (app *application) buildDataExport(ctx context.Context, export *store.DataExport) {
+	logger := app.logger.With("export_id", export.ID, "user_id", export.UserID)
+
+	if export.Attempts > maxExportAttempts {
+		app.failDataExport(ctx, export, errors.New("building did not complete"))
+		return
+	}
+
+	user, err := app.store.Users.GetById(ctx, export.UserID)
+	if err != nil {
+		app.failDataExport(ctx, export, err)
+		return
+	}
+
+	file, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		app.failDataExport(ctx, export, err)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := app.writeDataExport(ctx, file, user); err != nil {
+		app.failDataExport(ctx, export, err)
+		return
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		app.failDataExport(ctx, export, err)
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.failDataExport(ctx, export, err)
+		return
+	}
+
+	export.Key = fmt.Sprintf("exports/%d/%s.zip", user.ID, uuid.New())
+	export.Size = size
+
+	if err := app.blobStorage.Put(ctx, export.Key, file, size, "application/zip"); err != nil {
+		app.failDataExport(ctx, export, err)
+		return
+	}
+
+	plainToken := uuid.New().String()
+
+	if err := app.store.DataExports.Complete(ctx, export, plainToken); err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			logger.Error("error completing data export", "error", err)
+		}
+		app.deleteBlob(export.Key)
+		return
+	}
+
+	logger.Info("data export ready", "size", size)
+
+	app.sendDataExport(user.Username, user.Email, plainToken)
+}
+
+// writeDataExport writes the JSON documents of a user and their media to a
+// ZIP archive.
+func (app *application) writeDataExport(ctx context.Context, w io.Writer, user *store.User) error {
+	data, err := app.store.DataExports.UserData(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+
+	documents := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", user},
+		{"posts.json", data.Posts},
+		{"comments.json", data.Comments},
+		{"followers.json", data.Followers},
+		{"following.json", data.Following},
+		{"uploads.json", data.Uploads},
+	}
+
+	for _, doc := range documents {
+		f, err := archive.Create(doc.name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(doc.data); err != nil {
+			return err
+		}
+	}
+
+	// media are stored under their blob key
+	var keys []string
+	for _, upload := range data.Uploads {
+		keys = append(keys, upload.Key)
+	}
+	for _, post := range data.Posts {
+		for _, a := range post.Attachments {
+			keys = append(keys, a.Key)
+		}
+		for _, img := range post.Images {
+			if key, ok := img.Variants["original"]; ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if err := app.addExportMedia(ctx, archive, key); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func (app *application) addExportMedia(ctx context.Context, archive *zip.Writer, key string) error {
+	body, err := app.blobStorage.Get(ctx, key)
+	if err != nil {
+		// uploads whose file is already gone are listed without it
+		if errors.Is(err, blob.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	defer body.Close()
+
+	f, err := archive.CreateHeader(&zip.FileHeader{
+		Name:   path.Join("media", key),
+		Method: zip.Store, // media are already compressed
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, body)
+	return err
+}
+
+func (app *application) failDataExport(ctx context.Context, export *store.DataExport, err error) {
+	app.logger.Error("error building data export", "export_id", export.ID, "user_id", export.UserID, "error", err)
+
+	// an export interrupted by the shutdown is claimed again once stale
+	if ctx.Err() != nil {
+		return
+	}
+
+	// a lost claim is left to the worker that holds it now
+	if err := app.store.DataExports.Fail(ctx, export, "the export could not be prepared"); err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.logger.Error("error failing data export", "export_id", export.ID, "error", err)
+	}
+}
+
+func (app *application) sendDataExport(username, email, plainToken string) {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username    string
+		DownloadURL string
+		Expiry      string
+	}{
+		Username:    username,
+		DownloadURL: fmt.Sprintf("%s/v1/users/export/%s", app.config.publicURL, plainToken),
+		Expiry:      app.config.exports.expiry.String(),
+	}
+
+	status, err := app.mailer.Send(mailer.DataExportTemplate, username, email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Error("error sending data export email", "email", email, "error", err)
+		return
+	}
+
+	app.logger.Info("Email sent", "status code", status)
+}
+
+// runExportSweeper periodically deletes expired exports and their archives.
+func (app *application) runExportSweeper(ctx context.Context) {
+	ticker := time.NewTicker(app.config.exports.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sweepDataExports(ctx)
+		}
+	}
+}
+
+func (app *application) sweepDataExports(ctx context.Context) {
+	keys, err := app.store.DataExports.DeleteExpired(ctx)
+	if err != nil {
+		app.logger.Error("error deleting expired data exports", "error", err)
+		return
+	}
+
+	for _, key := range keys {
+		app.deleteBlob(key)
+	}
+
+	app.logger.Info("deleted expired data exports", "count", len(keys))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pendingExportStore hands its pending exports out once and records how they
+// ended.
+type pendingExportStore struct {
+	store.MockDataExportStore
+	pending []store.DataExport
+	tokens  map[int64]string
+	failed  []int64
+}
+
+func (s *pendingExportStore) ClaimPending(ctx context.Context, limit int, staleAfter time.Duration) ([]store.DataExport, error) {
+	exports := s.pending
+	s.pending = nil
+	return exports, nil
+}
+
+func (s *pendingExportStore) Complete(ctx context.Context, export *store.DataExport, token string) error {
+	s.tokens[export.ID] = token
+	export.Status = store.DataExportReady
+	return nil
+}
+
+func (s *pendingExportStore) Fail(ctx context.Context, export *store.DataExport, reason string) error {
+	s.failed = append(s.failed, export.ID)
+	export.Status = store.DataExportFailed
+	return nil
+}
+
+func TestDataExport(t *testing.T) {
+	app := newTestApplication(t, config{})
+	ctx := context.Background()
+
+	t.Run("should archive the user data and media", func(t *testing.T) {
+		avatar := []byte("avatar")
+		if err := app.blobStorage.Put(ctx, "avatars/1/avatar.png", bytes.NewReader(avatar), int64(len(avatar)), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := app.writeDataExport(ctx, &buf, &store.User{ID: 1, Username: "test"}); err != nil {
+			t.Fatal(err)
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := make(map[string]*zip.File)
+		for _, f := range archive.File {
+			files[f.Name] = f
+		}
+
+		for _, name := range []string{"profile.json", "posts.json", "comments.json", "followers.json", "following.json", "uploads.json"} {
+			if _, ok := files[name]; !ok {
+				t.Errorf("expected %s in the archive", name)
+			}
+		}
+
+		media, ok := files["media/avatars/1/avatar.png"]
+		if !ok {
+			t.Fatal("expected the avatar in the archive")
+		}
+
+		rc, err := media.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+
+		if got, _ := io.ReadAll(rc); !bytes.Equal(got, avatar) {
+			t.Errorf("expected the avatar content, got %q", got)
+		}
+	})
+
+	t.Run("should notify the export processor of new requests", func(t *testing.T) {
+		app.exportNotify = make(chan struct{}, 1)
+		defer func() { app.exportNotify = nil }()
+
+		testToken, err := app.authenticator.GenerateToken(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/me/export", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusAccepted, executeRequest(req, app.mount()).Code)
+
+		select {
+		case <-app.exportNotify:
+		default:
+			t.Error("expected the export processor to be notified")
+		}
+	})
+
+	t.Run("should build claimed exports and email their download link", func(t *testing.T) {
+		exports := &pendingExportStore{
+			pending: []store.DataExport{{ID: 1, UserID: 1, Attempts: 1}},
+			tokens:  make(map[int64]string),
+		}
+		app.store.DataExports = exports
+		defer func() { app.store.DataExports = &store.MockDataExportStore{} }()
+
+		app.processDataExports(ctx)
+
+		token, ok := exports.tokens[1]
+		if !ok {
+			t.Fatalf("expected export 1 to complete, failed %v", exports.failed)
+		}
+
+		sent := app.mailer.(*mailer.MockMailer).Sent()
+		if len(sent) != 1 || sent[0].Template != mailer.DataExportTemplate || !strings.Contains(fmt.Sprint(sent[0].Data), token) {
+			t.Errorf("expected the download link to be emailed, got %+v", sent)
+		}
+	})
+
+	t.Run("should fail exports claimed too often", func(t *testing.T) {
+		exports := &pendingExportStore{
+			pending: []store.DataExport{{ID: 2, UserID: 1, Attempts: maxExportAttempts + 1}},
+			tokens:  make(map[int64]string),
+		}
+		app.store.DataExports = exports
+		defer func() { app.store.DataExports = &store.MockDataExportStore{} }()
+
+		app.processDataExports(ctx)
+
+		if len(exports.failed) != 1 || exports.failed[0] != 2 || len(exports.tokens) != 0 {
+			t.Errorf("expected export 2 to fail, got failed %v and completed %v", exports.failed, exports.tokens)
+		}
+	})
+
+	t.Run("should not download unknown exports", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/export/unknown", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, app.mount()).Code)
+	})
+}
@@ -4,6 +4,9 @@ import (
 	"github/hassanharga/go-social/internal/store"
 	"github/hassanharga/go-social/utils"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
 )
 
 // getUserFeedHandler godoc
@@ -45,13 +48,161 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	ctx := r.Context()
-	feed, err := app.store.Posts.GetFeed(ctx, int64(82), fq)
+	feed, err := app.store.Posts.GetFeed(ctx, getUserFromCtx(r).ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	posts := make([]*store.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+
+	if err := app.loadAttachments(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	if err = app.jsonResponse(w, http.StatusOK, feed); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
+
+// getUserPostsHandler godoc
+//
+//	@Summary		Fetches the posts of a user
+//	@Description	Fetches the posts of a user with their comment counts, filtered like the feed. The posts of a private account are only shown to its followers, and not to users it blocked or who blocked it
+//	@Tags			feed
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			since	query		string	false	"Since"
+//	@Param			until	query		string	false	"Until"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Search"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/posts [get]
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err = fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// hidden timelines are reported like unknown users
+	visible, err := app.store.Followers.CanSeePosts(ctx, userID, getUserFromCtx(r).ID)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	feed, err := app.store.Posts.GetUserPosts(ctx, userID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]*store.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
+
+	if err := app.loadAttachments(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err = app.jsonResponse(w, http.StatusOK, feed); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getDraftsHandler godoc
+//
+//	@Summary		Fetches the drafts of the current user
+//	@Description	Fetches the draft and scheduled posts of the current user, filtered like the feed
+//	@Tags			feed
+//	@Produce		json
+//	@Param			since	query		string	false	"Since"
+//	@Param			until	query		string	false	"Until"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Tags"
+//	@Param			search	query		string	false	"Search"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/drafts [get]
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	drafts, err := app.store.Posts.GetDrafts(ctx, getUserFromCtx(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]*store.Post, len(drafts))
+	for i := range drafts {
+		posts[i] = &drafts[i].Post
+	}
+
+	if err := app.loadAttachments(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err = app.jsonResponse(w, http.StatusOK, drafts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
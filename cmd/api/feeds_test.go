@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"testing"
+)
+
+func TestGetUserPosts(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should list the posts of a user with their comment counts", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/2/posts?tags=go,sql&sort=asc&since=2025-01-01+00:00:00", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data []store.PostWithMetadata `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(body.Data) != 1 || body.Data[0].UserID != 2 || body.Data[0].CommentsCount != 2 {
+			t.Errorf("unexpected posts %v", body.Data)
+		}
+	})
+
+	t.Run("should hide the posts of users the caller can't see", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/4/posts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should reject invalid filters", func(t *testing.T) {
+		for _, query := range []string{"sort=newest", "limit=50", "tags=a,b,c,d,e,f"} {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/2/posts?"+query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var errFollowRequestNotFound = errors.New("follow request not found")
+
+// getFollowRequestsHandler godoc
+//
+//	@Summary		Lists the follow requests of the current user
+//	@Description	Lists the pending requests to follow the private account of the current user, newest first. Pass the returned next_cursor to fetch the next page
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Page size, up to 100"
+//	@Param			cursor	query		string	false	"Cursor of the next page"
+//	@Success		200		{object}	store.FollowRequestPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests [get]
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFollowQuery{
+		Limit: 20,
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	page, err := app.store.Followers.GetFollowRequests(r.Context(), getUserFromCtx(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// approveFollowRequestHandler godoc
+//
+//	@Summary		Approves a follow request
+//	@Description	Makes the requester a follower of the current user and notifies them by email
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path	int	true	"Requester ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{id}/approve [put]
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	if err := app.store.Followers.ApproveFollowRequest(ctx, user.ID, requesterID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, errFollowRequestNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.followRequestsApproved(ctx, user, requesterID)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// rejectFollowRequestHandler godoc
+//
+//	@Summary		Rejects a follow request
+//	@Description	Deletes a pending follow request without notifying the requester
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path	int	true	"Requester ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{id}/reject [put]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Followers.RejectFollowRequest(r.Context(), getUserFromCtx(r).ID, requesterID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, errFollowRequestNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// followRequestsApproved drops the cached counts and suggestions touched by
+// approved follow requests and emails the requesters.
+func (app *application) followRequestsApproved(ctx context.Context, user *store.User, requesterIDs ...int64) {
+	if len(requesterIDs) == 0 {
+		return
+	}
+
+	app.invalidateFollowCounts(ctx, user.ID)
+	app.invalidateFollowCounts(ctx, requesterIDs...)
+	app.invalidateSuggestions(ctx, requesterIDs...)
+
+	for _, requesterID := range requesterIDs {
+		// the follow is already approved, only the email is skipped
+		requester, err := app.store.Users.GetById(ctx, requesterID)
+		if err != nil {
+			app.logger.Error("error fetching follow requester", "user_id", requesterID, "error", err)
+			continue
+		}
+
+		go app.sendFollowRequestApproved(requester.Username, requester.Email, user.Username)
+	}
+}
+
+func (app *application) sendFollowRequestApproved(username, email, followedUsername string) {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username         string
+		FollowedUsername string
+	}{
+		Username:         username,
+		FollowedUsername: followedUsername,
+	}
+
+	status, err := app.mailer.Send(mailer.FollowRequestApprovedTemplate, username, email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Error("error sending follow request approval email", "email", email, "error", err)
+		return
+	}
+
+	app.logger.Info("Email sent", "status code", status)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// resendActivationHandler godoc
+//
+//	@Summary		Resends the activation email
+//	@Description	Issues a fresh invitation token for an account that is not activated yet. The response is the same whether the email exists or not
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResendActivationPayload	true	"User email"
+//	@Success		202		{string}	string					"Activation email requested"
+//	@Failure		400		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/activation/resend [post]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if allow, retryAfter := app.activationLimiter.Allow(strings.ToLower(payload.Email)); !allow {
+		app.rateLimitExceededError(w, r, retryAfter.String())
+		return
+	}
+
+	plainToken := uuid.New().String()
+
+	user, err := app.store.Users.Reinvite(r.Context(), payload.Email, plainToken, app.config.mail.expiry)
+	switch err {
+	case nil:
+		go func() {
+			status, err := app.sendActivationEmail(user, plainToken)
+			if err != nil {
+				app.logger.Error("error sending activation email", "user_id", user.ID, "error", err)
+				return
+			}
+
+			app.logger.Info("Email sent", "status code", status)
+		}()
+	case store.ErrNotFound:
+	default:
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"message": "if the email belongs to an inactive account, an activation link has been sent",
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, data); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// runInvitationSweeper periodically purges expired invitations and, when
+// enabled, accounts that were never activated within the grace period.
+func (app *application) runInvitationSweeper(ctx context.Context) {
+	ticker := time.NewTicker(app.config.invitations.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sweepInvitations(ctx)
+		}
+	}
+}
+
+func (app *application) sweepInvitations(ctx context.Context) {
+	purged, err := app.store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		app.logger.Error("error purging expired invitations", "error", err)
+		return
+	}
+
+	app.logger.Info("purged expired invitations", "count", purged)
+
+	if !app.config.invitations.deleteInactive {
+		return
+	}
+
+	deleted, err := app.store.Users.DeleteInactive(ctx, app.config.invitations.inactiveGracePeriod)
+	if err != nil {
+		app.logger.Error("error deleting inactive users", "error", err)
+		return
+	}
+
+	app.logger.Info("deleted inactive users", "count", deleted)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// invitationStore records the sweeps of invitations and inactive users.
+type invitationStore struct {
+	store.MockUserStore
+	invitationSweeps int
+	inactiveGrace    []time.Duration
+}
+
+func (s *invitationStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	s.invitationSweeps++
+	return 2, nil
+}
+
+func (s *invitationStore) DeleteInactive(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	s.inactiveGrace = append(s.inactiveGrace, gracePeriod)
+	return 1, nil
+}
+
+func TestResendActivation(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	resend := func(t *testing.T, email string) int {
+		req, err := http.NewRequest(http.MethodPost, "/v1/auth/activation/resend", strings.NewReader(`{"email":"`+email+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should throttle resends per email", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			checkResponseCode(t, http.StatusAccepted, resend(t, "test@example.com"))
+		}
+
+		// the limit ignores the case of the email
+		checkResponseCode(t, http.StatusTooManyRequests, resend(t, "TEST@example.com"))
+	})
+
+	t.Run("should not throttle other emails", func(t *testing.T) {
+		checkResponseCode(t, http.StatusAccepted, resend(t, "other@example.com"))
+	})
+}
+
+func TestSweepInvitations(t *testing.T) {
+	tests := []struct {
+		name           string
+		deleteInactive bool
+		inactiveGrace  []time.Duration
+	}{
+		{"should only purge expired invitations by default", false, nil},
+		{"should delete never activated users after the grace period", true, []time.Duration{time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t, config{invitations: invitationConfig{
+				deleteInactive:      tt.deleteInactive,
+				inactiveGracePeriod: time.Hour,
+			}})
+
+			users := &invitationStore{}
+			app.store.Users = users
+
+			app.sweepInvitations(context.Background())
+
+			if users.invitationSweeps != 1 {
+				t.Errorf("expected expired invitations to be purged once, got %d", users.invitationSweeps)
+			}
+
+			if len(users.inactiveGrace) != len(tt.inactiveGrace) || (len(tt.inactiveGrace) > 0 && users.inactiveGrace[0] != tt.inactiveGrace[0]) {
+				t.Errorf("expected inactive users deleted with %v, got %v", tt.inactiveGrace, users.inactiveGrace)
+			}
+		})
+	}
+}
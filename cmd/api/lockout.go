@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPasswordHash is compared against when the email is unknown, so the
+// response takes as long as a wrong password for an existing account.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func compareDummyPassword(password string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+}
+
+var (
+	errAccountLocked      = errors.New("account is locked")
+	errInvalidCredentials = errors.New("invalid email or password")
+)
+
+// recordLoginFailure counts a failed login and notifies the user when it
+// locked the account, reporting whether it did. Failures of unknown users
+// are not counted.
+func (app *application) recordLoginFailure(ctx context.Context, user *store.User) (bool, error) {
+	lockout, err := app.store.Lockouts.RecordFailure(ctx, user.ID, app.config.auth.lockout)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if lockout.LockedUntil == nil {
+		return false, nil
+	}
+
+	app.logger.Warn("account locked", "user_id", user.ID, "locked_until", lockout.LockedUntil)
+
+	go app.sendAccountLocked(user, *lockout.LockedUntil)
+
+	return true, nil
+}
+
+// isAccountLocked reports whether too many failed logins locked the account.
+func (app *application) isAccountLocked(ctx context.Context, userID int64) (bool, error) {
+	lockout, err := app.store.Lockouts.Get(ctx, userID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return lockout.IsLocked(time.Now()), nil
+}
+
+func (app *application) sendAccountLocked(user *store.User, lockedUntil time.Time) {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username    string
+		LockedUntil string
+		ResetURL    string
+	}{
+		Username:    user.Username,
+		LockedUntil: lockedUntil.UTC().Format(time.RFC1123),
+		ResetURL:    fmt.Sprintf("%s/forgot-password", app.config.frontendURL),
+	}
+
+	status, err := app.mailer.Send(mailer.AccountLockedTemplate, user.Username, user.Email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Error("error sending account locked email", "user_id", user.ID, "error", err)
+		return
+	}
+
+	app.logger.Info("Email sent", "status code", status)
+}
+
+// unlockUserHandler godoc
+//
+//	@Summary		Unlocks an account
+//	@Description	Clears the failed login attempts and the lock of an account. Admins only
+//	@Tags			users
+//	@Produce		json
+//	@Param			id	path		int		true	"User ID"
+//	@Success		200	{string}	string	"Account unlocked"
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/unlock [post]
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	allowed, err := app.checkRolePrecedence(ctx, getUserFromCtx(r), store.ADMIN)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !allowed {
+		app.forbiddenError(w, r)
+		return
+	}
+
+	if _, err := app.store.Users.GetById(ctx, userID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Lockouts.Reset(ctx, userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "account unlocked"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
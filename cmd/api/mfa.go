@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/internal/totp"
+	"github/hassanharga/go-social/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	mfaPendingTokenType = "mfa_pending"
+	recoveryCodesCount  = 10
+	// accepted clock drift in TOTP periods
+	totpSkew = 1
+)
+
+var errInvalidMFACode = errors.New("invalid verification code")
+
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFACodePayload struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type CreateTokenMFAPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+// createTokenMFAHandler godoc
+//
+//	@Summary		Completes a two-factor login
+//	@Description	Exchanges the mfa token returned by /auth/token and a TOTP or recovery code for a token pair
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateTokenMFAPayload	true	"MFA token and code"
+//	@Success		200		{object}	TokenPair
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/token/mfa [post]
+func (app *application) createTokenMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateTokenMFAPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(payload.MFAToken)
+	if err != nil {
+		app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
+		return
+	}
+
+	claims, err := parseTokenClaims(jwtToken)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+
+	if claims.tokenType != mfaPendingTokenType {
+		app.unauthorizedError(w, r, fmt.Errorf("not an mfa token"))
+		return
+	}
+
+	ctx := r.Context()
+
+	revoked, err := app.isTokenRevoked(ctx, claims)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if revoked {
+		app.unauthorizedError(w, r, fmt.Errorf("token has been revoked"))
+		return
+	}
+
+	user, err := app.store.Users.GetById(ctx, claims.userID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// wrong codes count as failed logins, and the challenge ends with the
+	// lock they cause so codes can't be guessed for the whole token lifetime
+	locked, err := app.isAccountLocked(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if locked {
+		if err := app.revokeToken(ctx, claims); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		app.unauthorizedError(w, r, errAccountLocked)
+		return
+	}
+
+	if err := app.verifyMFACode(ctx, mfa, payload.Code); err != nil {
+		switch err {
+		case errInvalidMFACode:
+			locked, err := app.recordLoginFailure(ctx, user)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			if locked {
+				if err := app.revokeToken(ctx, claims); err != nil {
+					app.internalServerError(w, r, err)
+					return
+				}
+			}
+
+			app.unauthorizedError(w, r, errInvalidMFACode)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the mfa token is single use
+	if err := app.revokeToken(ctx, claims); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Lockouts.Reset(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens, err := app.issueTokens(ctx, claims.userID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// enrollTOTPHandler godoc
+//
+//	@Summary		Starts TOTP enrollment
+//	@Description	Generates a TOTP secret for the current user. It has to be verified before it is enabled
+//	@Tags			users
+//	@Produce		json
+//	@Success		201	{object}	TOTPEnrollment
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp [post]
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	encrypted, err := app.totpCipher.Encrypt(secret)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.SetSecret(r.Context(), user.ID, encrypted); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictError(w, r, errors.New("two-factor authentication is already enabled"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	enrollment := TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(app.config.auth.mfa.issuer, user.Email, secret),
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// verifyTOTPHandler godoc
+//
+//	@Summary		Enables TOTP
+//	@Description	Verifies the first code of a pending TOTP secret, enables it and returns single-use recovery codes
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFACodePayload	true	"TOTP code"
+//	@Success		200		{object}	RecoveryCodes
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp/verify [post]
+func (app *application) verifyTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if mfa.Enabled {
+		app.conflictError(w, r, errors.New("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := app.totpCipher.Decrypt(mfa.Secret)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	step, ok := totp.Validate(secret, payload.Code, time.Now(), totpSkew)
+	if !ok {
+		app.badRequestError(w, r, errInvalidMFACode)
+		return
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.Enable(ctx, user.ID, step, codes); err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictError(w, r, errors.New("two-factor authentication is already enabled"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, RecoveryCodes{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// disableTOTPHandler godoc
+//
+//	@Summary		Disables TOTP
+//	@Description	Disables two-factor authentication after confirming a TOTP or recovery code
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFACodePayload	true	"TOTP or recovery code"
+//	@Success		200		{string}	string			"Two-factor authentication disabled"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp [delete]
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	ctx := r.Context()
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !mfa.Enabled {
+		app.notFoundError(w, r, errors.New("two-factor authentication is not enabled"))
+		return
+	}
+
+	if err := app.verifyMFACode(ctx, mfa, payload.Code); err != nil {
+		switch err {
+		case errInvalidMFACode:
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.MFA.Disable(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"message": "two-factor authentication disabled",
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// verifyMFACode accepts either a TOTP code or an unused recovery code for an
+// enabled secret. Every code is only accepted once.
+func (app *application) verifyMFACode(ctx context.Context, mfa *store.UserMFA, code string) error {
+	if !mfa.Enabled {
+		return errInvalidMFACode
+	}
+
+	code = strings.TrimSpace(code)
+
+	if len(code) != totp.Digits {
+		err := app.store.MFA.UseRecoveryCode(ctx, mfa.UserID, strings.ToLower(code))
+		if err == store.ErrNotFound {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	secret, err := app.totpCipher.Decrypt(mfa.Secret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	if err := app.store.MFA.UseStep(ctx, mfa.UserID, step); err != nil {
+		if err == store.ErrConflict {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (app *application) generateMFAToken(userID int64) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"jti": uuid.New().String(),
+		"typ": mfaPendingTokenType,
+		"exp": time.Now().Add(app.config.auth.mfa.tokenExp).Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.jwt.iss,
+		"aud": app.config.auth.jwt.aud,
+	}
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+// generateRecoveryCodes returns codes formatted as two groups of five
+// lowercase base32 characters, e.g. "abcde-fghij".
+func generateRecoveryCodes(n int) ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github/hassanharga/go-social/internal/auth"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/internal/totp"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// credentialStore has the single user test@example.com, whose password is
+// "secret".
+type credentialStore struct {
+	store.MockUserStore
+	user *store.User
+}
+
+func newCredentialStore(t *testing.T) *credentialStore {
+	user := &store.User{ID: 1, Username: "test", Email: "test@example.com"}
+	if err := user.Password.Set("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	return &credentialStore{user: user}
+}
+
+func (s *credentialStore) GetByEmail(ctx context.Context, email string) (*store.User, error) {
+	if email != s.user.Email {
+		return nil, store.ErrNotFound
+	}
+	return s.user, nil
+}
+
+func (s *credentialStore) GetById(ctx context.Context, userID int64) (*store.User, error) {
+	if userID != s.user.ID {
+		return nil, store.ErrNotFound
+	}
+	return s.user, nil
+}
+
+// mfaStore keeps the TOTP secret of a single user, accepting each step and
+// recovery code once.
+type mfaStore struct {
+	store.MockMFAStore
+	mfa   *store.UserMFA
+	codes map[string]bool
+}
+
+func (s *mfaStore) GetByUserID(ctx context.Context, userID int64) (*store.UserMFA, error) {
+	if s.mfa == nil {
+		return nil, store.ErrNotFound
+	}
+	mfa := *s.mfa
+	return &mfa, nil
+}
+
+func (s *mfaStore) SetSecret(ctx context.Context, userID int64, secret []byte) error {
+	if s.mfa != nil && s.mfa.Enabled {
+		return store.ErrConflict
+	}
+	s.mfa = &store.UserMFA{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (s *mfaStore) Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error {
+	s.mfa.Enabled = true
+	s.mfa.LastUsedStep = step
+	s.codes = make(map[string]bool)
+	for _, code := range recoveryCodes {
+		s.codes[code] = true
+	}
+	return nil
+}
+
+func (s *mfaStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	if step <= s.mfa.LastUsedStep {
+		return store.ErrConflict
+	}
+	s.mfa.LastUsedStep = step
+	return nil
+}
+
+func (s *mfaStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	if !s.codes[code] {
+		return store.ErrNotFound
+	}
+	delete(s.codes, code)
+	return nil
+}
+
+// lockoutStore applies the lockout policy in memory.
+type lockoutStore struct {
+	lockouts map[int64]*store.AccountLockout
+}
+
+func newLockoutStore() *lockoutStore {
+	return &lockoutStore{lockouts: make(map[int64]*store.AccountLockout)}
+}
+
+func (s *lockoutStore) Get(ctx context.Context, userID int64) (*store.AccountLockout, error) {
+	lockout, ok := s.lockouts[userID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	l := *lockout
+	return &l, nil
+}
+
+func (s *lockoutStore) RecordFailure(ctx context.Context, userID int64, policy store.LockoutPolicy) (*store.AccountLockout, error) {
+	lockout, ok := s.lockouts[userID]
+	if !ok {
+		lockout = &store.AccountLockout{UserID: userID}
+		s.lockouts[userID] = lockout
+	}
+
+	lockout.FailedAttempts++
+	if lockout.FailedAttempts < policy.MaxAttempts {
+		return &store.AccountLockout{UserID: userID, FailedAttempts: lockout.FailedAttempts}, nil
+	}
+
+	lockout.Lockouts++
+	lockedUntil := time.Now().Add(policy.Duration(lockout.Lockouts))
+	lockout.FailedAttempts = 0
+	lockout.LockedUntil = &lockedUntil
+
+	l := *lockout
+	return &l, nil
+}
+
+func (s *lockoutStore) Reset(ctx context.Context, userID int64) error {
+	delete(s.lockouts, userID)
+	return nil
+}
+
+func newLockoutPolicy() store.LockoutPolicy {
+	return store.LockoutPolicy{MaxAttempts: 3, BaseDuration: time.Minute, MaxDuration: time.Hour}
+}
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	app := newTestApplication(t, config{auth: authConfig{
+		mfa:     mfaConfig{issuer: "GoSocial", tokenExp: time.Minute * 5},
+		lockout: newLockoutPolicy(),
+	}})
+	// the challenge is a token of its own type
+	app.authenticator = &auth.TestClaimsAuthenticator{}
+	mux := app.mount()
+
+	users := newCredentialStore(t)
+	mfa := &mfaStore{}
+	lockouts := newLockoutStore()
+	app.store.Users = users
+	app.store.MFA = mfa
+	app.store.Lockouts = lockouts
+	app.store.RevokedTokens = &revokedTokenStore{}
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(t *testing.T, method, url, body string, authenticated bool, data any) int {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authenticated {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+
+		rr := executeRequest(req, mux)
+
+		if data != nil && rr.Code < 300 {
+			envelope := struct {
+				Data any `json:"data"`
+			}{Data: data}
+			if err := json.NewDecoder(rr.Body).Decode(&envelope); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rr.Code
+	}
+
+	challenge := func(t *testing.T) string {
+		var c MFAChallenge
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPost, "/v1/auth/token", `{"email":"test@example.com","password":"secret"}`, false, &c))
+
+		if !c.MFARequired || c.MFAToken == "" {
+			t.Fatalf("expected an mfa challenge, got %+v", c)
+		}
+		return c.MFAToken
+	}
+
+	var enrollment TOTPEnrollment
+	var recovery RecoveryCodes
+	var enabledStep int64
+
+	t.Run("should enroll a TOTP secret", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, do(t, http.MethodPost, "/v1/users/me/mfa/totp", "", true, &enrollment))
+
+		if enrollment.Secret == "" || !strings.HasPrefix(enrollment.URI, "otpauth://totp/") {
+			t.Errorf("unexpected enrollment %+v", enrollment)
+		}
+	})
+
+	t.Run("should not enable the secret with a wrong code", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodPost, "/v1/users/me/mfa/totp/verify", `{"code":"000000"}`, true, nil))
+	})
+
+	t.Run("should enable the secret and return recovery codes", func(t *testing.T) {
+		enabledStep = totp.Step(time.Now())
+		code, err := totp.Code(enrollment.Secret, enabledStep)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPost, "/v1/users/me/mfa/totp/verify", `{"code":"`+code+`"}`, true, &recovery))
+
+		if len(recovery.RecoveryCodes) != recoveryCodesCount {
+			t.Errorf("expected %d recovery codes, got %v", recoveryCodesCount, recovery.RecoveryCodes)
+		}
+
+		checkResponseCode(t, http.StatusConflict, do(t, http.MethodPost, "/v1/users/me/mfa/totp", "", true, nil))
+	})
+
+	t.Run("should challenge the login and accept a recovery code once", func(t *testing.T) {
+		body := `{"mfa_token":"` + challenge(t) + `","code":"` + recovery.RecoveryCodes[0] + `"}`
+
+		var tokens TokenPair
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodPost, "/v1/auth/token/mfa", body, false, &tokens))
+
+		if tokens.AccessToken == "" {
+			t.Errorf("expected a token pair, got %+v", tokens)
+		}
+
+		body = `{"mfa_token":"` + challenge(t) + `","code":"` + recovery.RecoveryCodes[0] + `"}`
+		checkResponseCode(t, http.StatusUnauthorized, do(t, http.MethodPost, "/v1/auth/token/mfa", body, false, nil))
+	})
+
+	t.Run("should not accept a TOTP code twice", func(t *testing.T) {
+		// the code was used to enable the secret
+		code, err := totp.Code(enrollment.Secret, enabledStep)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := `{"mfa_token":"` + challenge(t) + `","code":"` + code + `"}`
+		checkResponseCode(t, http.StatusUnauthorized, do(t, http.MethodPost, "/v1/auth/token/mfa", body, false, nil))
+	})
+
+	t.Run("should end the challenge once wrong codes lock the account", func(t *testing.T) {
+		lockouts.Reset(context.Background(), 1)
+		mfaToken := challenge(t)
+
+		for i := 0; i < app.config.auth.lockout.MaxAttempts; i++ {
+			body := `{"mfa_token":"` + mfaToken + `","code":"wrong-code"}`
+			checkResponseCode(t, http.StatusUnauthorized, do(t, http.MethodPost, "/v1/auth/token/mfa", body, false, nil))
+		}
+
+		// even once the lock is lifted, the challenge is gone
+		lockouts.Reset(context.Background(), 1)
+
+		body := `{"mfa_token":"` + mfaToken + `","code":"` + recovery.RecoveryCodes[1] + `"}`
+		checkResponseCode(t, http.StatusUnauthorized, do(t, http.MethodPost, "/v1/auth/token/mfa", body, false, nil))
+	})
+
+	t.Run("should reject the challenge of a locked account", func(t *testing.T) {
+		mfaToken := challenge(t)
+
+		lockedUntil := time.Now().Add(time.Minute)
+		lockouts.lockouts[1] = &store.AccountLockout{UserID: 1, Lockouts: 1, LockedUntil: &lockedUntil}
+
+		body := `{"mfa_token":"` + mfaToken + `","code":"` + recovery.RecoveryCodes[1] + `"}`
+		checkResponseCode(t, http.StatusUnauthorized, do(t, http.MethodPost, "/v1/auth/token/mfa", body, false, nil))
+	})
+}
@@ -6,10 +6,8 @@ import (
 	"fmt"
 	"github/hassanharga/go-social/internal/store"
 	"net/http"
-	"strconv"
 	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
+	"time"
 )
 
 func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
@@ -30,24 +28,45 @@ func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		token := parts[1]
+
+		// personal access tokens are opaque and looked up in the database
+		if strings.HasPrefix(token, personalTokenPrefix) {
+			app.authenticatePersonalToken(w, r, next, token)
+			return
+		}
+
 		jwtToken, err := app.authenticator.ValidateToken(token)
 		if err != nil {
 			app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
 			return
 		}
 
-		claims := jwtToken.Claims.(jwt.MapClaims)
-
-		userId, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+		claims, err := parseTokenClaims(jwtToken)
 		if err != nil {
-			app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
+			app.unauthorizedError(w, r, err)
+			return
+		}
+
+		if claims.tokenType != "" {
+			app.unauthorizedError(w, r, fmt.Errorf("%s token can not be used for authentication", claims.tokenType))
 			return
 		}
 
 		ctx := r.Context()
 
+		revoked, err := app.isTokenRevoked(ctx, claims)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if revoked {
+			app.unauthorizedError(w, r, fmt.Errorf("token has been revoked"))
+			return
+		}
+
 		// fetch user data
-		user, err := app.getUser(ctx, userId)
+		user, err := app.getUser(ctx, claims.userID)
 		if err != nil {
 			app.unauthorizedError(w, r, err)
 			return
@@ -60,6 +79,60 @@ func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+func (app *application) authenticatePersonalToken(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	ctx := r.Context()
+
+	pat, err := app.store.PersonalTokens.Authenticate(ctx, token)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// fetch user data
+	user, err := app.getUser(ctx, pat.UserID)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+
+	ctx = context.WithValue(ctx, userCtxKey, user)
+	ctx = context.WithValue(ctx, personalTokenCtxKey, pat)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requireScope restricts requests authenticated with a personal access token
+// to tokens granted the scope. Session tokens carry every scope.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pat := getPersonalTokenFromCtx(r); pat != nil && !pat.HasScope(scope) {
+				app.forbiddenError(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// denyPersonalTokens keeps account management out of reach of scripts.
+func (app *application) denyPersonalTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getPersonalTokenFromCtx(r) != nil {
+			app.forbiddenError(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) basicMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -163,6 +236,48 @@ func (app *application) getUser(ctx context.Context, userId int64) (*store.User,
 	return user, nil
 }
 
+func (app *application) isTokenRevoked(ctx context.Context, claims *tokenClaims) (bool, error) {
+	if !app.config.cache.enabled {
+		return app.store.RevokedTokens.IsRevoked(ctx, claims.jti, claims.userID, claims.issuedAt)
+	}
+
+	return app.cacheStorage.Tokens.IsRevoked(ctx, claims.jti, claims.userID, claims.issuedAt)
+}
+
+func (app *application) revokeToken(ctx context.Context, claims *tokenClaims) error {
+	ttl := time.Until(claims.expiresAt)
+	// an expired token is already rejected
+	if ttl <= 0 {
+		return nil
+	}
+
+	if !app.config.cache.enabled {
+		return app.store.RevokedTokens.Revoke(ctx, claims.jti, claims.userID, claims.expiresAt)
+	}
+
+	return app.cacheStorage.Tokens.Revoke(ctx, claims.jti, ttl)
+}
+
+// revokeUserTokens revokes every access token, refresh session and personal
+// access token of a user.
+func (app *application) revokeUserTokens(ctx context.Context, userID int64) error {
+	if err := app.store.Sessions.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := app.store.PersonalTokens.DeleteAll(ctx, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if !app.config.cache.enabled {
+		return app.store.RevokedTokens.RevokeAll(ctx, userID, now)
+	}
+
+	return app.cacheStorage.Tokens.RevokeAll(ctx, userID, now, app.config.auth.jwt.exp)
+}
+
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.rateLimiter.Enabled {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// revokedTokenStore reports the tokens with the jti as revoked, and records
+// new revocations.
+type revokedTokenStore struct {
+	store.MockRevokedTokenStore
+	jti          string
+	revoked      []string
+	revokedUsers []int64
+}
+
+func (s *revokedTokenStore) RevokeAll(ctx context.Context, userID int64, before time.Time) error {
+	s.revokedUsers = append(s.revokedUsers, userID)
+	return nil
+}
+
+func (s *revokedTokenStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	s.revoked = append(s.revoked, jti)
+	return nil
+}
+
+func (s *revokedTokenStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	return jti == s.jti || slices.Contains(s.revoked, jti), nil
+}
+
+func TestAuthTokenMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		revokedJTI string
+		status     int
+	}{
+		{"should accept a valid token", "other-jti", http.StatusOK},
+		{"should reject a revoked token", "test-jti", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.store.RevokedTokens = &revokedTokenStore{jti: tt.revokedJTI}
+
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/me", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, tt.status, executeRequest(req, mux).Code)
+		})
+	}
+
+	t.Run("should not store the revocation of an expired token", func(t *testing.T) {
+		revoked := &revokedTokenStore{}
+		app.store.RevokedTokens = revoked
+
+		claims := &tokenClaims{jti: "expired-jti", userID: 1, expiresAt: time.Now().Add(-time.Minute)}
+
+		if err := app.revokeToken(context.Background(), claims); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(revoked.revoked) != 0 {
+			t.Errorf("expected no revocation, got %v", revoked.revoked)
+		}
+	})
+}
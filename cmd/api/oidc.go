@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/oidc"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateExp    = time.Minute * 10
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// oidcLoginHandler godoc
+//
+//	@Summary		Starts a login with an external provider
+//	@Description	Redirects to the OpenID Connect provider using the authorization code flow with PKCE
+//	@Tags			auth
+//	@Param			provider	path	string	true	"Provider name"
+//	@Success		302
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/auth/oidc/{provider}/login [get]
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundError(w, r, errors.New("unknown provider"))
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the nonce and verifier stay on the server, the browser only gets the
+	// state to bind the callback to it
+	loginState := &store.LoginState{
+		Provider: provider.Name(),
+		Nonce:    nonce,
+		Verifier: verifier,
+	}
+
+	if err := app.store.Identities.CreateLoginState(r.Context(), state, loginState, oidcStateExp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/v1/auth/oidc",
+		MaxAge:   int(oidcStateExp.Seconds()),
+		HttpOnly: true,
+		Secure:   app.config.env == "production",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler godoc
+//
+//	@Summary		Finishes a login with an external provider
+//	@Description	Redeems the authorization code and issues a token pair, or an MFA challenge when the account has two-factor authentication. Unknown identities get a new account. Accounts are not linked automatically by email: when an account has the same verified email, a 202 is returned and its owner is emailed a link to confirm, and the login succeeds once confirmed
+//	@Tags			auth
+//	@Produce		json
+//	@Param			provider	path		string	true	"Provider name"
+//	@Param			code		query		string	true	"Authorization code"
+//	@Param			state		query		string	true	"State"
+//	@Success		200			{object}	TokenPair
+//	@Success		202			{string}	string	"Link confirmation sent"
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/auth/oidc/{provider}/callback [get]
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundError(w, r, errors.New("unknown provider"))
+		return
+	}
+
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		app.unauthorizedError(w, r, fmt.Errorf("provider returned %s", errCode))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		app.badRequestError(w, r, errors.New("missing login state"))
+		return
+	}
+
+	// the state is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/v1/auth/oidc",
+		MaxAge: -1,
+	})
+
+	state := r.URL.Query().Get("state")
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		app.badRequestError(w, r, errors.New("state mismatch"))
+		return
+	}
+
+	ctx := r.Context()
+
+	loginState, err := app.store.Identities.ConsumeLoginState(ctx, provider.Name(), state)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.badRequestError(w, r, errors.New("invalid login state"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, r.URL.Query().Get("code"), loginState.Verifier, loginState.Nonce)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+
+	user, err := app.userFromIdentity(ctx, provider.Name(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errIdentityLinkPending):
+			if err := app.jsonResponse(w, http.StatusAccepted, map[string]string{"message": "check your email to link this account"}); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		case errors.Is(err, errUnverifiedEmail):
+			app.unauthorizedError(w, r, err)
+		case errors.Is(err, store.ErrConflict), errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	locked, err := app.isAccountLocked(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if locked {
+		app.unauthorizedError(w, r, errAccountLocked)
+		return
+	}
+
+	app.completeLogin(w, r, user.ID)
+}
+
+// confirmIdentityLinkHandler godoc
+//
+//	@Summary		Confirms linking a provider identity
+//	@Description	Links the identity of a provider login using the token sent to the owner of the account with the same email
+//	@Tags			auth
+//	@Produce		json
+//	@Param			token	path		string	true	"Confirmation token"
+//	@Success		200		{string}	string	"Identity linked"
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/oidc/link/{token} [put]
+func (app *application) confirmIdentityLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := app.store.Identities.ConfirmLink(r.Context(), chi.URLParam(r, "token")); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		case store.ErrConflict:
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "identity linked"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+var (
+	errUnverifiedEmail     = errors.New("the provider did not verify the email")
+	errIdentityLinkPending = errors.New("the owner of the account must confirm the link")
+)
+
+// userFromIdentity returns the user linked to the provider identity. Unknown
+// identities get a new account, unless an account has the same verified
+// email: its owner is then asked by email to confirm the link. Linking is
+// never automatic, a provider vouching for an email doesn't prove that the
+// owner of the local account agrees to sign in with it.
+func (app *application) userFromIdentity(ctx context.Context, provider string, claims *oidc.Claims) (*store.User, error) {
+	user, err := app.store.Identities.GetUser(ctx, provider, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if err != store.ErrNotFound {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+
+	identity := &store.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err = app.store.Users.GetByEmail(ctx, claims.Email)
+	switch err {
+	case nil:
+		identity.UserID = user.ID
+		if err := app.requestIdentityLink(ctx, user, identity); err != nil {
+			return nil, err
+		}
+		return nil, errIdentityLinkPending
+	case store.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	return app.createUserFromIdentity(ctx, claims, identity)
+}
+
+func (app *application) requestIdentityLink(ctx context.Context, user *store.User, identity *store.Identity) error {
+	plainToken := uuid.New().String()
+
+	if err := app.store.Identities.CreateLinkRequest(ctx, identity, plainToken, app.config.mail.identityLinkExpiry); err != nil {
+		return err
+	}
+
+	go app.sendIdentityLink(user, identity.Provider, plainToken)
+
+	return nil
+}
+
+func (app *application) sendIdentityLink(user *store.User, provider, plainToken string) {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username   string
+		Provider   string
+		ConfirmURL string
+		Expiry     string
+	}{
+		Username:   user.Username,
+		Provider:   provider,
+		ConfirmURL: fmt.Sprintf("%s/confirm-link/%s", app.config.frontendURL, plainToken),
+		Expiry:     app.config.mail.identityLinkExpiry.String(),
+	}
+
+	status, err := app.mailer.Send(mailer.IdentityLinkTemplate, user.Username, user.Email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Error("error sending identity link confirmation", "user_id", user.ID, "error", err)
+		return
+	}
+
+	app.logger.Info("Email sent", "status code", status)
+}
+
+func (app *application) createUserFromIdentity(ctx context.Context, claims *oidc.Claims, identity *store.Identity) (*store.User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	base = usernameInvalidChars.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 80 {
+		base = base[:80]
+	}
+
+	// the account can only be used through the provider until a password
+	// is set with the reset flow
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	const maxAttempts = 3
+	for attempt := range maxAttempts {
+		username := base
+		if attempt > 0 {
+			username = fmt.Sprintf("%s-%s", base, uuid.New().String()[:8])
+		}
+
+		user := &store.User{
+			Username: username,
+			Email:    claims.Email,
+			Role: store.Role{
+				Name: "user",
+			},
+		}
+
+		if err := user.Password.Set(password); err != nil {
+			return nil, err
+		}
+
+		err := app.store.Users.CreateWithIdentity(ctx, user, identity)
+		if err == store.ErrDuplicateUsername {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	}
+
+	return nil, store.ErrDuplicateUsername
+}
+
+// runOIDCSweeper periodically purges the login states and link requests that
+// were never completed.
+func (app *application) runOIDCSweeper(ctx context.Context) {
+	ticker := time.NewTicker(app.config.auth.oidcSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sweepOIDC(ctx)
+		}
+	}
+}
+
+func (app *application) sweepOIDC(ctx context.Context) {
+	purged, err := app.store.Identities.DeleteExpired(ctx)
+	if err != nil {
+		app.logger.Error("error purging expired provider logins", "error", err)
+		return
+	}
+
+	app.logger.Info("purged expired provider logins", "count", purged)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/oidc"
+	"github/hassanharga/go-social/internal/oidc/oidctest"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// identityStore keeps the login states, link requests and links in memory.
+type identityStore struct {
+	store.MockIdentityStore
+	states   map[string]*store.LoginState
+	requests map[string]*store.Identity
+	links    map[string]int64
+}
+
+func newIdentityStore() *identityStore {
+	return &identityStore{
+		states:   make(map[string]*store.LoginState),
+		requests: make(map[string]*store.Identity),
+		links:    make(map[string]int64),
+	}
+}
+
+func (s *identityStore) GetUser(ctx context.Context, provider, subject string) (*store.User, error) {
+	userID, ok := s.links[provider+"/"+subject]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &store.User{ID: userID}, nil
+}
+
+func (s *identityStore) CreateLinkRequest(ctx context.Context, identity *store.Identity, token string, exp time.Duration) error {
+	s.requests[token] = identity
+	return nil
+}
+
+func (s *identityStore) ConfirmLink(ctx context.Context, token string) (*store.Identity, error) {
+	identity, ok := s.requests[token]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	delete(s.requests, token)
+
+	s.links[identity.Provider+"/"+identity.Subject] = identity.UserID
+	return identity, nil
+}
+
+func (s *identityStore) CreateLoginState(ctx context.Context, state string, loginState *store.LoginState, exp time.Duration) error {
+	s.states[state] = loginState
+	return nil
+}
+
+func (s *identityStore) ConsumeLoginState(ctx context.Context, provider, state string) (*store.LoginState, error) {
+	loginState, ok := s.states[state]
+	if !ok || loginState.Provider != provider {
+		return nil, store.ErrNotFound
+	}
+	delete(s.states, state)
+	return loginState, nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	server, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	app := newTestApplication(t, config{auth: authConfig{
+		mfa:     mfaConfig{tokenExp: time.Minute * 5},
+		lockout: newLockoutPolicy(),
+	}})
+	app.oidcProviders = map[string]*oidc.Provider{
+		"test": oidc.NewProvider(oidc.Config{
+			Name:         "test",
+			Issuer:       server.Issuer(),
+			ClientID:     oidctest.ClientID,
+			ClientSecret: oidctest.ClientSecret,
+			RedirectURL:  "http://localhost/v1/auth/oidc/test/callback",
+		}, server.Client()),
+	}
+	mux := app.mount()
+
+	identities := newIdentityStore()
+	mfa := &mfaStore{}
+	lockouts := newLockoutStore()
+	app.store.Identities = identities
+	app.store.Users = newCredentialStore(t)
+	app.store.MFA = mfa
+	app.store.Lockouts = lockouts
+
+	// login starts the flow and the fake provider redirects back with a code
+	login := func(t *testing.T) (*http.Cookie, url.Values) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/auth/oidc/test/login", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusFound, rr.Code)
+
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+			t.Fatalf("expected the %s cookie, got %v", oidcStateCookie, cookies)
+		}
+
+		client := server.Client()
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+
+		resp, err := client.Get(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return cookies[0], callback.Query()
+	}
+
+	callback := func(cookie *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/v1/auth/oidc/test/callback?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.AddCookie(cookie)
+
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should issue tokens for a new verified identity", func(t *testing.T) {
+		cookie, query := login(t)
+
+		checkResponseCode(t, http.StatusOK, callback(cookie, query).Code)
+	})
+
+	t.Run("should keep the verifier and nonce out of the cookie", func(t *testing.T) {
+		cookie, query := login(t)
+
+		if cookie.Value != query.Get("state") {
+			t.Errorf("expected the cookie to only hold the state, got %q", cookie.Value)
+		}
+	})
+
+	t.Run("should reject a mismatched state", func(t *testing.T) {
+		cookie, query := login(t)
+		query.Set("state", "forged")
+
+		checkResponseCode(t, http.StatusBadRequest, callback(cookie, query).Code)
+	})
+
+	t.Run("should not complete a login twice", func(t *testing.T) {
+		cookie, query := login(t)
+
+		checkResponseCode(t, http.StatusOK, callback(cookie, query).Code)
+		checkResponseCode(t, http.StatusBadRequest, callback(cookie, query).Code)
+	})
+
+	t.Run("should reject unverified emails of unknown identities", func(t *testing.T) {
+		server.User.EmailVerified = false
+		defer func() { server.User.EmailVerified = true }()
+
+		cookie, query := login(t)
+
+		checkResponseCode(t, http.StatusUnauthorized, callback(cookie, query).Code)
+	})
+
+	// the account of test@example.com exists, the provider account is new
+	server.User.Subject = "subject-2"
+	server.User.Email = "test@example.com"
+
+	t.Run("should ask the owner to confirm linking an account with the same email", func(t *testing.T) {
+		cookie, query := login(t)
+
+		checkResponseCode(t, http.StatusAccepted, callback(cookie, query).Code)
+
+		if len(identities.links) != 0 || len(identities.requests) != 1 {
+			t.Fatalf("expected a pending link request, got links %v and requests %v", identities.links, identities.requests)
+		}
+
+		// the email is sent in the background
+		deadline := time.Now().Add(time.Second)
+		for len(app.mailer.(*mailer.MockMailer).Sent()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		sent := app.mailer.(*mailer.MockMailer).Sent()
+		if len(sent) != 1 || sent[0].Template != mailer.IdentityLinkTemplate || sent[0].Email != "test@example.com" {
+			t.Errorf("expected a link confirmation email, got %+v", sent)
+		}
+	})
+
+	t.Run("should link the identity once confirmed", func(t *testing.T) {
+		var token string
+		for token = range identities.requests {
+		}
+
+		confirm := func() int {
+			req, err := http.NewRequest(http.MethodPut, "/v1/auth/oidc/link/"+token, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return executeRequest(req, mux).Code
+		}
+
+		checkResponseCode(t, http.StatusOK, confirm())
+		checkResponseCode(t, http.StatusNotFound, confirm())
+
+		cookie, query := login(t)
+		checkResponseCode(t, http.StatusOK, callback(cookie, query).Code)
+	})
+
+	t.Run("should challenge accounts with two-factor authentication", func(t *testing.T) {
+		mfa.mfa = &store.UserMFA{UserID: 1, Enabled: true}
+		defer func() { mfa.mfa = nil }()
+
+		cookie, query := login(t)
+
+		rr := callback(cookie, query)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var envelope struct {
+			Data MFAChallenge `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&envelope); err != nil {
+			t.Fatal(err)
+		}
+
+		if !envelope.Data.MFARequired || envelope.Data.MFAToken == "" {
+			t.Errorf("expected an mfa challenge, got %+v", envelope.Data)
+		}
+	})
+
+	t.Run("should reject locked accounts", func(t *testing.T) {
+		lockedUntil := time.Now().Add(time.Minute)
+		lockouts.lockouts[1] = &store.AccountLockout{UserID: 1, Lockouts: 1, LockedUntil: &lockedUntil}
+		defer lockouts.Reset(context.Background(), 1)
+
+		cookie, query := login(t)
+
+		checkResponseCode(t, http.StatusUnauthorized, callback(cookie, query).Code)
+	})
+
+	t.Run("should return not found for unknown providers", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/auth/oidc/unknown/login", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+	})
+}
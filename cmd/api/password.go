@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/utils"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+// forgotPasswordHandler godoc
+//
+//	@Summary		Requests a password reset
+//	@Description	Emails a one-time password reset link. The response is the same whether the email exists or not
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ForgotPasswordPayload	true	"User email"
+//	@Success		202		{string}	string					"Reset requested"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	switch err {
+	case nil:
+		// the reset is sent in the background so the response time does not
+		// reveal whether the email belongs to an account
+		go app.sendPasswordReset(user)
+	case store.ErrNotFound:
+	default:
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"message": "if the email belongs to an account, a reset link has been sent",
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, data); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) sendPasswordReset(user *store.User) {
+	ctx := context.Background()
+
+	plainToken := uuid.New().String()
+
+	if err := app.store.Users.CreatePasswordReset(ctx, user.ID, plainToken, app.config.mail.passwordResetExpiry); err != nil {
+		app.logger.Error("error creating password reset", "user_id", user.ID, "error", err)
+		return
+	}
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username string
+		ResetURL string
+		Expiry   string
+	}{
+		Username: user.Username,
+		ResetURL: fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken),
+		Expiry:   app.config.mail.passwordResetExpiry.String(),
+	}
+
+	status, err := app.mailer.Send(mailer.PasswordResetTemplate, user.Username, user.Email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Error("error sending password reset email", "user_id", user.ID, "error", err)
+		return
+	}
+
+	app.logger.Info("Email sent", "status code", status)
+}
+
+// resetPasswordHandler godoc
+//
+//	@Summary		Resets a password
+//	@Description	Sets a new password using a reset token and signs the user out everywhere
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResetPasswordPayload	true	"Reset token and new password"
+//	@Success		200		{string}	string					"Password reset"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/auth/password/reset [post]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.Users.ResetPassword(ctx, payload.Token, payload.Password)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.revokeUserTokens(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if app.config.cache.enabled {
+		app.cacheStorage.Users.Delete(ctx, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "password reset"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
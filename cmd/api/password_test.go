@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// passwordResetStore keeps the reset tokens of user 1, each usable once
+// until it expires.
+type passwordResetStore struct {
+	store.MockUserStore
+	mu      sync.Mutex
+	tokens  map[string]time.Time
+	created chan string
+}
+
+func (s *passwordResetStore) GetByEmail(ctx context.Context, email string) (*store.User, error) {
+	if email != "test@example.com" {
+		return nil, store.ErrNotFound
+	}
+	return &store.User{ID: 1, Username: "test", Email: email}, nil
+}
+
+func (s *passwordResetStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(exp)
+	s.mu.Unlock()
+
+	s.created <- token
+	return nil
+}
+
+func (s *passwordResetStore) ResetPassword(ctx context.Context, token string, newPassword string) (*store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, ok := s.tokens[token]
+	delete(s.tokens, token)
+
+	if !ok || time.Now().After(expiry) {
+		return nil, store.ErrNotFound
+	}
+	return &store.User{ID: 1}, nil
+}
+
+// sessionStore records the users whose sessions were revoked.
+type sessionStore struct {
+	store.MockSessionStore
+	revoked []int64
+}
+
+func (s *sessionStore) RevokeAll(ctx context.Context, userID int64) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t, config{mail: mailConfig{passwordResetExpiry: time.Hour}})
+	mux := app.mount()
+
+	users := &passwordResetStore{tokens: make(map[string]time.Time), created: make(chan string, 1)}
+	sessions := &sessionStore{}
+	app.store.Users = users
+	app.store.Sessions = sessions
+	app.store.RevokedTokens = &revokedTokenStore{}
+
+	post := func(t *testing.T, url, body string) int {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(req, mux).Code
+	}
+
+	var token string
+
+	t.Run("should email a reset token", func(t *testing.T) {
+		checkResponseCode(t, http.StatusAccepted, post(t, "/v1/auth/password/forgot", `{"email":"test@example.com"}`))
+
+		select {
+		case token = <-users.created:
+		case <-time.After(time.Second):
+			t.Fatal("expected a reset token")
+		}
+
+		// the email is sent right after the token is stored
+		deadline := time.Now().Add(time.Second)
+		for len(app.mailer.(*mailer.MockMailer).Sent()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		sent := app.mailer.(*mailer.MockMailer).Sent()
+		if len(sent) != 1 || sent[0].Template != mailer.PasswordResetTemplate || sent[0].Email != "test@example.com" {
+			t.Errorf("expected a reset email, got %+v", sent)
+		}
+	})
+
+	t.Run("should answer the same for unknown emails", func(t *testing.T) {
+		checkResponseCode(t, http.StatusAccepted, post(t, "/v1/auth/password/forgot", `{"email":"unknown@example.com"}`))
+	})
+
+	t.Run("should reset the password and sign out everywhere", func(t *testing.T) {
+		body := `{"token":"` + token + `","password":"new-password"}`
+		checkResponseCode(t, http.StatusOK, post(t, "/v1/auth/password/reset", body))
+
+		if len(sessions.revoked) != 1 || sessions.revoked[0] != 1 {
+			t.Errorf("expected the sessions of user 1 to be revoked, got %v", sessions.revoked)
+		}
+
+		if revoked := app.store.RevokedTokens.(*revokedTokenStore).revokedUsers; len(revoked) != 1 || revoked[0] != 1 {
+			t.Errorf("expected the access tokens of user 1 to be revoked, got %v", revoked)
+		}
+	})
+
+	t.Run("should not reuse a token", func(t *testing.T) {
+		body := `{"token":"` + token + `","password":"other-password"}`
+		checkResponseCode(t, http.StatusNotFound, post(t, "/v1/auth/password/reset", body))
+	})
+
+	t.Run("should not accept an expired token", func(t *testing.T) {
+		users.tokens["expired"] = time.Now().Add(-time.Minute)
+
+		checkResponseCode(t, http.StatusNotFound, post(t, "/v1/auth/password/reset", `{"token":"expired","password":"new-password"}`))
+	})
+}
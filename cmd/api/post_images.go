@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/imaging"
+	"github/hassanharga/go-social/internal/store"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// images left processing for longer are claimed again
+	imageStaleAfter = time.Minute * 10
+	// an image is failed once it was claimed more often without completing
+	maxImageAttempts = 3
+)
+
+// postImages checks that the uploads belong to the user and are images, and
+// returns the pending post images created from them.
+func (app *application) postImages(ctx context.Context, userID int64, uploadIDs []string) ([]store.PostImage, error) {
+	images := make([]store.PostImage, 0, len(uploadIDs))
+
+	for _, id := range uploadIDs {
+		upload, err := app.store.Uploads.GetByID(ctx, id)
+		if err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+
+		// uploads of other users are reported as missing
+		if err == store.ErrNotFound || upload.UserID != userID {
+			return nil, fmt.Errorf("%w: upload %s not found", errInvalidImage, id)
+		}
+
+		if upload.Kind != store.UploadKindAttachment || !strings.HasPrefix(upload.ContentType, "image/") {
+			return nil, fmt.Errorf("%w: upload %s is not an image", errInvalidImage, id)
+		}
+
+		images = append(images, store.PostImage{
+			UploadID:  upload.ID,
+			SourceKey: upload.Key,
+			Status:    store.PostImagePending,
+		})
+	}
+
+	return images, nil
+}
+
+// notifyImageProcessor wakes the image processor up without waiting for its
+// next tick.
+func (app *application) notifyImageProcessor() {
+	select {
+	case app.imageNotify <- struct{}{}:
+	default:
+	}
+}
+
+// runImageProcessor processes the images of new posts in the background, on
+// every tick and whenever a post with images is created.
+func (app *application) runImageProcessor(ctx context.Context) {
+	ticker := time.NewTicker(app.config.uploads.imageInterval)
+	defer ticker.Stop()
+
+	for {
+		app.processImages(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-app.imageNotify:
+		}
+	}
+}
+
+// processImages works through the pending images in batches until none are
+// left.
+func (app *application) processImages(ctx context.Context) {
+	for ctx.Err() == nil {
+		images, err := app.store.PostImages.ClaimPending(ctx, app.config.uploads.imageBatchSize, imageStaleAfter)
+		if err != nil {
+			app.logger.Error("error claiming post images", "error", err)
+			return
+		}
+
+		if len(images) == 0 {
+			return
+		}
+
+		for i := range images {
+			app.processImage(ctx, &images[i])
+		}
+	}
+}
+
+// processImage generates the variants of an image. Storage errors leave it
+// processing so it is retried once stale, while images that can not be
+// decoded are failed right away.
+func (app *application) processImage(ctx context.Context, img *store.PostImage) {
+	logger := app.logger.With("image_id", img.ID, "post_id", img.PostID)
+
+	if img.Attempts > maxImageAttempts {
+		app.failImage(ctx, img, "processing did not complete")
+		return
+	}
+
+	data, err := app.readBlob(ctx, img.SourceKey)
+	if err != nil {
+		logger.Error("error reading image", "error", err)
+		return
+	}
+
+	result, err := imaging.Process(data, imaging.DefaultSizes)
+	if err != nil {
+		switch err {
+		case imaging.ErrUnsupportedFormat, imaging.ErrTooLarge:
+			app.failImage(ctx, img, err.Error())
+		default:
+			logger.Error("error processing image", "error", err)
+		}
+		return
+	}
+
+	img.Width = result.Width
+	img.Height = result.Height
+	img.Blurhash = result.Blurhash
+	img.Variants = make(map[string]string, len(result.Variants))
+
+	for _, v := range result.Variants {
+		key := fmt.Sprintf("images/%d/%d/%s%s", img.PostID, img.ID, v.Name, v.Ext)
+
+		if err := app.blobStorage.Put(ctx, key, bytes.NewReader(v.Data), int64(len(v.Data)), v.ContentType); err != nil {
+			logger.Error("error storing image variant", "variant", v.Name, "error", err)
+			app.deleteVariants(img)
+			return
+		}
+
+		img.Variants[v.Name] = key
+	}
+
+	if err := app.store.PostImages.Complete(ctx, img); err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			logger.Error("error completing image", "error", err)
+		}
+		app.deleteVariants(img)
+		return
+	}
+
+	// the original may still hold metadata, only the variants are kept
+	app.deleteBlob(img.SourceKey)
+
+	logger.Info("processed image", "width", img.Width, "height", img.Height)
+}
+
+func (app *application) failImage(ctx context.Context, img *store.PostImage, reason string) {
+	app.logger.Warn("image processing failed", "image_id", img.ID, "post_id", img.PostID, "reason", reason)
+
+	// a lost claim is left to the worker that holds it now
+	if err := app.store.PostImages.Fail(ctx, img, reason); err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.logger.Error("error failing image", "image_id", img.ID, "error", err)
+	}
+}
+
+func (app *application) deleteVariants(img *store.PostImage) {
+	for _, key := range img.Variants {
+		app.deleteBlob(key)
+	}
+}
+
+func (app *application) readBlob(ctx context.Context, key string) ([]byte, error) {
+	body, err := app.blobStorage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// signImageURLs sets the signed URLs of the variants of ready images.
+func (app *application) signImageURLs(ctx context.Context, images []store.PostImage) error {
+	for i := range images {
+		img := &images[i]
+		if img.Status != store.PostImageReady {
+			continue
+		}
+
+		img.URLs = make(map[string]string, len(img.Variants))
+		for name, key := range img.Variants {
+			signed, err := app.blobStorage.SignedURL(ctx, key, app.config.uploads.urlExpiry)
+			if err != nil {
+				return err
+			}
+			img.URLs[name] = signed
+		}
+	}
+
+	return nil
+}
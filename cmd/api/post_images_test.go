@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github/hassanharga/go-social/internal/blob"
+	"github/hassanharga/go-social/internal/store"
+	"image"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreatePostWithImages(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should attach pending images", func(t *testing.T) {
+		body := `{"title":"hello","content":"world","image_ids":["6f1c2a5e-3f5b-4c1e-9a4e-2b7c8d9e0f11"]}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var res struct {
+			Data struct {
+				Images []struct {
+					Status string `json:"status"`
+				} `json:"images"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Data.Images) != 1 || res.Data.Images[0].Status != store.PostImagePending {
+			t.Errorf("expected one pending image, got %+v", res.Data.Images)
+		}
+	})
+
+	t.Run("should reject invalid image ids", func(t *testing.T) {
+		body := `{"title":"hello","content":"world","image_ids":["not-an-id"]}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+}
+
+func TestProcessImage(t *testing.T) {
+	app := newTestApplication(t, config{uploads: uploadConfig{urlExpiry: time.Minute}})
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+
+	source := "attachments/1/source.png"
+	if err := app.blobStorage.Put(ctx, source, &buf, int64(buf.Len()), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	img := &store.PostImage{ID: 2, PostID: 1, SourceKey: source, Attempts: 1}
+	app.processImage(ctx, img)
+
+	if img.Width != 300 || img.Height != 200 {
+		t.Errorf("expected a processed 300x200 image, got %dx%d", img.Width, img.Height)
+	}
+
+	thumbnail, ok := img.Variants["thumbnail"]
+	if !ok {
+		t.Fatalf("expected a thumbnail variant, got %v", img.Variants)
+	}
+
+	if _, err := app.readBlob(ctx, thumbnail); err != nil {
+		t.Errorf("expected the thumbnail to be stored, got %v", err)
+	}
+
+	if _, err := app.blobStorage.Get(ctx, source); err != blob.ErrNotFound {
+		t.Errorf("expected the original to be deleted, got %v", err)
+	}
+}
+
+// lostClaimStore reports every claim as lost, as when the image was claimed
+// again after going stale.
+type lostClaimStore struct {
+	store.MockPostImageStore
+}
+
+func (s *lostClaimStore) Complete(ctx context.Context, img *store.PostImage) error {
+	return store.ErrNotFound
+}
+
+func TestProcessImageLostClaim(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store.PostImages = &lostClaimStore{}
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+
+	source := "attachments/1/source.png"
+	if err := app.blobStorage.Put(ctx, source, &buf, int64(buf.Len()), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	img := &store.PostImage{ID: 2, PostID: 1, SourceKey: source, Attempts: 1}
+	app.processImage(ctx, img)
+
+	for name, key := range img.Variants {
+		if _, err := app.blobStorage.Get(ctx, key); err != blob.ErrNotFound {
+			t.Errorf("expected the %s variant to be deleted, got %v", name, err)
+		}
+	}
+
+	// the worker holding the claim now still needs the original
+	if _, err := app.readBlob(ctx, source); err != nil {
+		t.Errorf("expected the original to be kept, got %v", err)
+	}
+}
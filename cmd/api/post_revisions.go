@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"github/hassanharga/go-social/internal/diff"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PostRevisionDiff is the word-level change of the title and content of a
+// post between two versions.
+type PostRevisionDiff struct {
+	PostID  int64        `json:"post_id"`
+	From    int          `json:"from"`
+	To      int          `json:"to"`
+	Title   []diff.Chunk `json:"title"`
+	Content []diff.Chunk `json:"content"`
+}
+
+// getPostRevisionsHandler godoc
+//
+//	@Summary		Fetches the edit history of a post
+//	@Description	Lists the previous titles and contents of a post, newest first, with who replaced them and when. Only the author and moderators can see it
+//	@Tags			posts
+//	@Produce		json
+//	@Param			id	path		int	true	"Post ID"
+//	@Success		200	{array}		store.PostRevision
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions [get]
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	revisions, err := app.store.PostRevisions.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getPostRevisionDiffHandler godoc
+//
+//	@Summary		Compares a revision of a post
+//	@Description	Diffs the title and content of a revision word by word against the next version, or against the version given with "to". Only the author and moderators can see it
+//	@Tags			posts
+//	@Produce		json
+//	@Param			id		path		int	true	"Post ID"
+//	@Param			version	path		int	true	"Version of the revision"
+//	@Param			to		query		int	false	"Later version to compare with"
+//	@Success		200		{object}	PostRevisionDiff
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{id}/revisions/{version}/diff [get]
+func (app *application) getPostRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	from, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	revisions, err := app.store.PostRevisions.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the post itself is the newest version
+	versions := append([]store.PostRevision{{
+		PostID:  post.ID,
+		Version: post.Version,
+		Title:   post.Title,
+		Content: post.Content,
+	}}, revisions...)
+
+	fromIdx := revisionIndex(versions, from)
+	if fromIdx == -1 {
+		app.notFoundError(w, r, errors.New("revision not found"))
+		return
+	}
+
+	toIdx := fromIdx - 1
+	if to := r.URL.Query().Get("to"); to != "" {
+		version, err := strconv.Atoi(to)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		if version <= from {
+			app.badRequestError(w, r, errors.New("to must be a later version"))
+			return
+		}
+
+		if toIdx = revisionIndex(versions, version); toIdx == -1 {
+			app.notFoundError(w, r, errors.New("revision not found"))
+			return
+		}
+	}
+
+	if toIdx < 0 {
+		app.badRequestError(w, r, errors.New("the current version has no later version"))
+		return
+	}
+
+	older, newer := versions[fromIdx], versions[toIdx]
+
+	res := PostRevisionDiff{
+		PostID:  post.ID,
+		From:    older.Version,
+		To:      newer.Version,
+		Title:   diff.Words(older.Title, newer.Title),
+		Content: diff.Words(older.Content, newer.Content),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revisionIndex returns the index of version in versions, or -1.
+func revisionIndex(versions []store.PostRevision, version int) int {
+	for i, v := range versions {
+		if v.Version == version {
+			return i
+		}
+	}
+	return -1
+}
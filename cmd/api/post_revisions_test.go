@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"github/hassanharga/go-social/internal/diff"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPostRevisions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(t *testing.T, url string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Result()
+	}
+
+	t.Run("should list the revisions", func(t *testing.T) {
+		res := get(t, "/v1/posts/1/revisions")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct {
+			Data []store.PostRevision `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(body.Data) != 2 || body.Data[0].Version != 1 {
+			t.Errorf("expected 2 revisions, newest first, got %+v", body.Data)
+		}
+	})
+
+	t.Run("should diff a revision with the next version", func(t *testing.T) {
+		res := get(t, "/v1/posts/1/revisions/1/diff")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct {
+			Data PostRevisionDiff `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []diff.Chunk{
+			{Op: diff.Equal, Text: "hello "},
+			{Op: diff.Delete, Text: "there"},
+			{Op: diff.Insert, Text: "big"},
+			{Op: diff.Equal, Text: " world"},
+		}
+
+		if body.Data.From != 1 || body.Data.To != 2 || !reflect.DeepEqual(body.Data.Content, want) {
+			t.Errorf("unexpected diff %+v", body.Data)
+		}
+	})
+
+	t.Run("should diff a revision with a later version", func(t *testing.T) {
+		res := get(t, "/v1/posts/1/revisions/0/diff?to=2")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct {
+			Data PostRevisionDiff `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []diff.Chunk{{Op: diff.Delete, Text: "hi"}, {Op: diff.Insert, Text: "hello"}}
+
+		if body.Data.From != 0 || body.Data.To != 2 || !reflect.DeepEqual(body.Data.Title, want) {
+			t.Errorf("unexpected diff %+v", body.Data)
+		}
+	})
+
+	t.Run("should reject invalid versions", func(t *testing.T) {
+		tests := []struct {
+			url    string
+			status int
+		}{
+			{"/v1/posts/1/revisions/first/diff", http.StatusBadRequest},
+			{"/v1/posts/1/revisions/2/diff", http.StatusBadRequest},
+			{"/v1/posts/1/revisions/1/diff?to=0", http.StatusBadRequest},
+			{"/v1/posts/1/revisions/5/diff", http.StatusNotFound},
+			{"/v1/posts/1/revisions/0/diff?to=5", http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			checkResponseCode(t, tt.status, get(t, tt.url).StatusCode)
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"github/hassanharga/go-social/utils"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -19,31 +20,59 @@ type CreatePostPayload struct {
 	Title   string   `json:"title" validate:"required,max=100"`
 	Content string   `json:"content" validate:"required,max=1000"`
 	Tags    []string `json:"tags"`
+	// uploads of images to attach, processed after the post is created
+	ImageIDs []string `json:"image_ids" validate:"omitempty,max=10,unique,dive,uuid"`
+	// details of the files sent with a multipart form, in the same order
+	Attachments []AttachmentPayload `json:"attachments" validate:"omitempty,max=4,dive"`
+	// published by default, scheduled posts are published at publish_at
+	Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
+var errInvalidImage = errors.New("invalid image")
+
 type UpdatePostPayload struct {
 	Title   string `json:"title" validate:"omitempty,max=100"`
 	Content string `json:"content" validate:"omitempty,max=1000"`
+	// publishes, schedules or reschedules a draft or scheduled post
+	Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 // CreatePost godoc
 //
 //	@Summary		Creates a post
-//	@Description	Creates a post
+//	@Description	Creates a post, published right away unless its status is draft, or scheduled with a publish_at in the future. Images uploaded beforehand are attached with image_ids and processed in the background, their status is reported on the post.
+//	@Description	Up to 4 files can be attached by sending a multipart form instead, with the JSON payload in the "payload" field and the files in "attachments" fields
 //	@Tags			posts
-//	@Accept			json
+//	@Accept			json,mpfd
 //	@Produce		json
-//	@Param			payload	body		CreatePostPayload	true	"Post payload"
-//	@Success		201		{object}	store.Post
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		500		{object}	error
+//	@Param			payload		body		CreatePostPayload	true	"Post payload"
+//	@Param			attachments	formData	file				false	"Attachment"
+//	@Success		201			{object}	store.Post
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		413			{object}	error
+//	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/posts [post]
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
 	// read data from body
 	var payload CreatePostPayload
-	if err := utils.ReadJson(w, r, &payload); err != nil {
+	var files [][]byte
+	if isMultipart(r) {
+		var err error
+		files, err = readPostForm(w, r, &payload, app.config.uploads.maxAttachmentSize)
+		if err != nil {
+			switch {
+			case errors.Is(err, errFileTooLarge):
+				app.payloadTooLargeError(w, r, err)
+			default:
+				app.badRequestError(w, r, err)
+			}
+			return
+		}
+	} else if err := utils.ReadJson(w, r, &payload); err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
@@ -54,19 +83,63 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	user := getUserFromCtx(r)
-
 	post := &store.Post{
 		Title:   payload.Title,
 		Content: payload.Content,
 		Tags:    payload.Tags,
-		UserID:  user.ID,
 	}
 
-	// validate the payload
+	if payload.Status == "" {
+		payload.Status = store.PostStatusPublished
+	}
+
+	if err := setPostStatus(post, payload.Status, payload.PublishAt); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
 	ctx := r.Context()
 
+	images, err := app.postImages(ctx, user.ID, payload.ImageIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidImage):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	attachments, err := app.storeAttachments(ctx, user.ID, files, payload.Attachments)
+	if err != nil {
+		app.uploadError(w, r, err)
+		return
+	}
+
+	post.UserID = user.ID
+	post.Images = images
+	post.Attachments = attachments
+
 	if err := app.store.Posts.Create(ctx, post); err != nil {
+		app.deleteAttachmentBlobs(attachments)
+
+		switch err {
+		case store.ErrConflict:
+			app.conflictError(w, r, errors.New("an image is already attached to another post"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if len(post.Images) > 0 {
+		app.notifyImageProcessor()
+	}
+
+	if err := app.signAttachmentURLs(ctx, post.Attachments); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -79,7 +152,7 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 // GetPost godoc
 //
 //	@Summary		Fetches a post
-//	@Description	Fetches a post by ID
+//	@Description	Fetches a post by ID. The posts of private accounts are only shown to their followers
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
@@ -96,7 +169,28 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comments, err := app.store.Comments.GetByPostId(r.Context(), post.ID)
+	viewer := getUserFromCtx(r)
+
+	// drafts and scheduled posts are only shown to their author
+	if post.Status != store.PostStatusPublished && post.UserID != viewer.ID {
+		app.notFoundError(w, r, errors.New("post not found"))
+		return
+	}
+
+	// the posts of private accounts are hidden from non-followers, and those
+	// of blocked users from each other, as if they didn't exist
+	visible, err := app.store.Followers.CanSeePosts(r.Context(), post.UserID, viewer.ID)
+	if err != nil && err != store.ErrNotFound {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !visible {
+		app.notFoundError(w, r, errors.New("post not found"))
+		return
+	}
+
+	comments, err := app.store.Comments.GetByPostId(r.Context(), post.ID, viewer.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -104,6 +198,24 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post.Comments = comments
 
+	images, err := app.store.PostImages.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.signImageURLs(r.Context(), images); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	post.Images = images
+
+	if err := app.loadAttachments(r.Context(), post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -133,7 +245,8 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 
 	ctx := r.Context()
 
-	if err := app.store.Posts.Delete(ctx, id); err != nil {
+	keys, err := app.store.Posts.Delete(ctx, id)
+	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFoundError(w, r, err)
@@ -144,6 +257,11 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	// attachments and image variants are only referenced by the post
+	for _, key := range keys {
+		app.deleteBlob(key)
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "post deleted successfully"}); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -152,7 +270,7 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 // UpdatePost godoc
 //
 //	@Summary		Updates a post
-//	@Description	Updates a post by ID
+//	@Description	Updates a post by ID. Drafts and scheduled posts can be published, scheduled or rescheduled, published posts stay published. The previous title and content are kept as a revision, and published posts are marked as edited
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
@@ -192,7 +310,19 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Content = payload.Content
 	}
 
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+	if payload.Status != "" || payload.PublishAt != nil {
+		status := payload.Status
+		if status == "" {
+			status = post.Status
+		}
+
+		if err := setPostStatus(post, status, payload.PublishAt); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.store.Posts.Update(r.Context(), post, getUserFromCtx(r).ID); err != nil {
 		// switch {
 		// case errors.Is(err, store.ErrNotFound):
 		// 	app.notFoundError(w, r, err)
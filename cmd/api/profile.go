@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/utils"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type UpdateUserPayload struct {
+	Username *string `json:"username" validate:"omitempty,min=1,max=100"`
+	Email    *string `json:"email" validate:"omitempty,email,max=255"`
+	Password *string `json:"password" validate:"omitempty,min=3,max=72"`
+	// profile fields are cleared with an empty string
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	Location    *string `json:"location" validate:"omitempty,max=100"`
+	Website     *string `json:"website" validate:"omitempty,max=255,len=0|http_url"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitempty,max=255,len=0|http_url"`
+	// a private account approves its followers, turning it public approves
+	// the pending requests
+	IsPrivate *bool `json:"is_private"`
+	// required to change the email or the password
+	CurrentPassword string `json:"current_password" validate:"max=72"`
+	// version the client read, the update is rejected when it is outdated
+	Version *int `json:"version"`
+}
+
+// getCurrentUserHandler godoc
+//
+//	@Summary		Fetches the current user
+//	@Description	Fetches the profile of the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.User
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [get]
+func (app *application) getCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.store.Users.GetById(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateCurrentUserHandler godoc
+//
+//	@Summary		Updates the current user
+//	@Description	Updates the username, profile, privacy and password of the authenticated user. A new email is only applied once it is confirmed from the link sent to it
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateUserPayload	true	"User payload"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateUserPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// the cached user may be outdated, the version has to come from the database
+	user, err := app.store.Users.GetById(ctx, getUserFromCtx(r).ID)
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if payload.Version != nil && *payload.Version != user.Version {
+		app.conflictError(w, r, errors.New("the user was modified, reload it and try again"))
+		return
+	}
+
+	changeEmail := payload.Email != nil && !strings.EqualFold(*payload.Email, user.Email)
+
+	if payload.Password != nil || changeEmail {
+		if err := app.checkCurrentPassword(ctx, user, payload.CurrentPassword); err != nil {
+			switch err {
+			case errWrongPassword:
+				app.badRequestError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	changed := false
+
+	if payload.Username != nil && *payload.Username != user.Username {
+		user.Username = *payload.Username
+		changed = true
+	}
+
+	for _, field := range []struct {
+		value *string
+		dst   *string
+	}{
+		{payload.DisplayName, &user.DisplayName},
+		{payload.Bio, &user.Bio},
+		{payload.Location, &user.Location},
+		{payload.Website, &user.Website},
+		{payload.AvatarURL, &user.AvatarURL},
+	} {
+		if field.value != nil && strings.TrimSpace(*field.value) != *field.dst {
+			*field.dst = strings.TrimSpace(*field.value)
+			changed = true
+		}
+	}
+
+	if payload.IsPrivate != nil && *payload.IsPrivate != user.IsPrivate {
+		user.IsPrivate = *payload.IsPrivate
+		changed = true
+	}
+
+	if payload.Password != nil {
+		if err := user.Password.Set(*payload.Password); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		changed = true
+	}
+
+	if changed {
+		approved, err := app.store.Users.Update(ctx, user)
+		if err != nil {
+			switch err {
+			case store.ErrNotFound:
+				app.conflictError(w, r, errors.New("the user was modified, reload it and try again"))
+			case store.ErrDuplicateUsername:
+				app.conflictError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		// the pending requests are approved when the account becomes public
+		app.followRequestsApproved(ctx, user, approved...)
+	}
+
+	// every device, this one included, has to sign in with the new password
+	if payload.Password != nil {
+		if err := app.revokeUserTokens(ctx, user.ID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if changeEmail {
+		plainToken := uuid.New().String()
+
+		if err := app.store.Users.CreateEmailChange(ctx, user.ID, *payload.Email, plainToken, app.config.mail.emailChangeExpiry); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		go app.sendEmailChange(user.Username, *payload.Email, plainToken)
+	}
+
+	if app.config.cache.enabled {
+		app.cacheStorage.Users.Delete(ctx, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// confirmEmailChangeHandler godoc
+//
+//	@Summary		Confirms a new email
+//	@Description	Applies a pending email change using the token sent to the new address
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	path		string	true	"Confirmation token"
+//	@Success		200		{string}	string	"Email updated"
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/email/confirm/{token} [put]
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	user, err := app.store.Users.ConfirmEmailChange(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		case store.ErrDuplicateEmail:
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if app.config.cache.enabled {
+		app.cacheStorage.Users.Delete(ctx, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "email updated"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+var errWrongPassword = errors.New("the current password is missing or incorrect")
+
+// checkCurrentPassword confirms a sensitive change with the password. Wrong
+// passwords count as failed logins, and locked accounts are refused, so a
+// stolen access token can't be used to guess the password.
+func (app *application) checkCurrentPassword(ctx context.Context, user *store.User, password string) error {
+	if password == "" {
+		return errWrongPassword
+	}
+
+	// only the lookup by email loads the password hash
+	credentials, err := app.store.Users.GetByEmail(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+
+	if err := credentials.Password.Compare(password); err != nil {
+		if _, err := app.recordLoginFailure(ctx, credentials); err != nil {
+			return err
+		}
+		return errWrongPassword
+	}
+
+	locked, err := app.isAccountLocked(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		return errWrongPassword
+	}
+
+	return nil
+}
+
+func (app *application) sendEmailChange(username, email, plainToken string) {
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username   string
+		ConfirmURL string
+		Expiry     string
+	}{
+		Username:   username,
+		ConfirmURL: fmt.Sprintf("%s/confirm-email/%s", app.config.frontendURL, plainToken),
+		Expiry:     app.config.mail.emailChangeExpiry.String(),
+	}
+
+	status, err := app.mailer.Send(mailer.EmailChangeTemplate, username, email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Error("error sending email change confirmation", "email", email, "error", err)
+		return
+	}
+
+	app.logger.Info("Email sent", "status code", status)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// privateAccountStore mocks every user as private, with requesters it
+// approves once the account is made public.
+type privateAccountStore struct {
+	store.MockUserStore
+	requesterIDs []int64
+}
+
+func (s *privateAccountStore) GetById(ctx context.Context, userID int64) (*store.User, error) {
+	return &store.User{ID: userID, Email: "user@example.com", IsPrivate: true}, nil
+}
+
+func (s *privateAccountStore) Update(ctx context.Context, user *store.User) ([]int64, error) {
+	if user.IsPrivate {
+		return nil, nil
+	}
+	return s.requesterIDs, nil
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(body string) int {
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should return the current user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should update the username", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, patch(`{"username":"new-name","version":0}`))
+	})
+
+	t.Run("should reject an outdated version", func(t *testing.T) {
+		checkResponseCode(t, http.StatusConflict, patch(`{"username":"new-name","version":3}`))
+	})
+
+	t.Run("should email the requesters approved by making the account public", func(t *testing.T) {
+		app.store.Users = &privateAccountStore{requesterIDs: []int64{5, 6}}
+		defer func() { app.store.Users = &store.MockUserStore{} }()
+
+		checkResponseCode(t, http.StatusOK, patch(`{"is_private":false,"version":0}`))
+
+		// the emails are sent in the background
+		deadline := time.Now().Add(time.Second)
+		for len(app.mailer.(*mailer.MockMailer).Sent()) < 2 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		sent := app.mailer.(*mailer.MockMailer).Sent()
+		if len(sent) != 2 || sent[0].Template != mailer.FollowRequestApprovedTemplate || sent[1].Template != mailer.FollowRequestApprovedTemplate {
+			t.Errorf("expected an approval email to each requester, got %+v", sent)
+		}
+	})
+
+	t.Run("should require the current password to change the password", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, patch(`{"password":"new-password"}`))
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	app := newTestApplication(t, config{auth: authConfig{lockout: newLockoutPolicy()}})
+	mux := app.mount()
+
+	lockouts := newLockoutStore()
+	revoked := &revokedTokenStore{}
+	app.store.Users = newCredentialStore(t)
+	app.store.Lockouts = lockouts
+	app.store.Sessions = &sessionStore{}
+	app.store.RevokedTokens = revoked
+	app.store.PersonalTokens = &personalTokenStore{}
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(body string) int {
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should revoke every token of the user", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, patch(`{"password":"new-password","current_password":"secret"}`))
+
+		if len(app.store.Sessions.(*sessionStore).revoked) != 1 || len(revoked.revokedUsers) != 1 || len(app.store.PersonalTokens.(*personalTokenStore).revokedUsers) != 1 {
+			t.Errorf("expected the sessions, access and personal access tokens of user 1 to be revoked")
+		}
+	})
+
+	t.Run("should count wrong current passwords as failed logins", func(t *testing.T) {
+		// the tokens were revoked by the password change
+		app.store.RevokedTokens = &revokedTokenStore{}
+		app.store.Users = newCredentialStore(t)
+
+		for i := 0; i < app.config.auth.lockout.MaxAttempts; i++ {
+			checkResponseCode(t, http.StatusBadRequest, patch(`{"password":"other-password","current_password":"wrong"}`))
+		}
+
+		if lockout, ok := lockouts.lockouts[1]; !ok || !lockout.IsLocked(time.Now()) {
+			t.Fatalf("expected user 1 to be locked, got %+v", lockout)
+		}
+
+		checkResponseCode(t, http.StatusBadRequest, patch(`{"password":"other-password","current_password":"secret"}`))
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github/hassanharga/go-social/internal/store"
+	"time"
+)
+
+var (
+	errInvalidSchedule  = errors.New("publish_at must be in the future and is only accepted for scheduled posts")
+	errAlreadyPublished = errors.New("a published post cannot go back to draft or be scheduled")
+)
+
+// setPostStatus moves a post to status. publishAt is required for scheduled
+// posts and rejected otherwise. Published posts stay published.
+func setPostStatus(post *store.Post, status string, publishAt *time.Time) error {
+	if post.Status == store.PostStatusPublished && status != store.PostStatusPublished {
+		return errAlreadyPublished
+	}
+
+	switch status {
+	case store.PostStatusScheduled:
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return errInvalidSchedule
+		}
+	default:
+		if publishAt != nil {
+			return errInvalidSchedule
+		}
+	}
+
+	post.Status = status
+	post.PublishAt = publishAt
+
+	return nil
+}
+
+// runPostScheduler periodically publishes the scheduled posts that are due.
+// Every replica runs it, the store publishes each post once.
+func (app *application) runPostScheduler(ctx context.Context) {
+	ticker := time.NewTicker(app.config.posts.publishInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.publishDuePosts(ctx)
+		}
+	}
+}
+
+func (app *application) publishDuePosts(ctx context.Context) {
+	for {
+		ids, err := app.store.Posts.PublishDue(ctx, app.config.posts.publishBatchSize)
+		if err != nil {
+			app.logger.Error("error publishing scheduled posts", "error", err)
+			return
+		}
+
+		if len(ids) > 0 {
+			app.logger.Info("published scheduled posts", "post_ids", ids)
+		}
+
+		// the backlog is cleared
+		if len(ids) < app.config.posts.publishBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetPostStatus(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		current   string
+		status    string
+		publishAt *time.Time
+		err       error
+	}{
+		{"should schedule a draft", store.PostStatusDraft, store.PostStatusScheduled, &future, nil},
+		{"should publish a scheduled post", store.PostStatusScheduled, store.PostStatusPublished, nil, nil},
+		{"should require a publish time to schedule", store.PostStatusDraft, store.PostStatusScheduled, nil, errInvalidSchedule},
+		{"should not schedule in the past", store.PostStatusDraft, store.PostStatusScheduled, &past, errInvalidSchedule},
+		{"should not accept a publish time for drafts", "", store.PostStatusDraft, &future, errInvalidSchedule},
+		{"should not unpublish a post", store.PostStatusPublished, store.PostStatusDraft, nil, errAlreadyPublished},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &store.Post{Status: tt.current}
+
+			if err := setPostStatus(post, tt.status, tt.publishAt); err != tt.err {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+
+			if tt.err == nil && (post.Status != tt.status || post.PublishAt != tt.publishAt) {
+				t.Errorf("unexpected post %+v", post)
+			}
+		})
+	}
+}
+
+func TestDrafts(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should create a scheduled post", func(t *testing.T) {
+		publishAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		body := fmt.Sprintf(`{"title":"hello","content":"world","status":"scheduled","publish_at":%q}`, publishAt)
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var res struct {
+			Data store.Post `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Data.Status != store.PostStatusScheduled || res.Data.PublishAt == nil {
+			t.Errorf("expected a scheduled post, got %+v", res.Data)
+		}
+	})
+
+	t.Run("should reject invalid schedules", func(t *testing.T) {
+		for _, body := range []string{
+			`{"title":"hello","content":"world","status":"scheduled"}`,
+			`{"title":"hello","content":"world","status":"draft","publish_at":"2100-01-01T00:00:00Z"}`,
+			`{"title":"hello","content":"world","status":"archived"}`,
+		} {
+			req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+		}
+	})
+
+	t.Run("should hide the drafts of other users", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should list the drafts of the current user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/drafts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data []store.PostWithMetadata `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Data) != 1 || res.Data[0].Status != store.PostStatusDraft {
+			t.Errorf("unexpected drafts %+v", res.Data)
+		}
+	})
+}
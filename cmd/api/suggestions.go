@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"strconv"
+)
+
+// suggestions ranked and cached per user, pages are cut from them
+const maxSuggestions = 50
+
+// getSuggestionsHandler godoc
+//
+//	@Summary		Suggests users to follow
+//	@Description	Ranks users the current user may want to follow by the number of followed users following them, the tags shared with the posts of the current user and their popularity. Followed, requested, blocked and muted users are excluded
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Number of suggestions, up to 50"
+//	@Success		200		{object}	[]store.Suggestion
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/suggestions [get]
+func (app *application) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxSuggestions {
+			app.badRequestError(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+	}
+
+	suggestions, err := app.getSuggestions(r.Context(), getUserFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getSuggestions(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	if !app.config.cache.enabled {
+		return app.store.Suggestions.GetSuggestions(ctx, userID, maxSuggestions)
+	}
+
+	// an unavailable cache only costs ranking the suggestions again
+	suggestions, err := app.cacheStorage.Suggestions.Get(ctx, userID)
+	if err != nil {
+		app.logger.Error("error reading cached suggestions", "user_id", userID, "error", err)
+	}
+
+	if suggestions == nil {
+		suggestions, err = app.store.Suggestions.GetSuggestions(ctx, userID, maxSuggestions)
+		if err != nil {
+			return nil, err
+		}
+
+		// the suggestions are ranked again on the next request
+		if err := app.cacheStorage.Suggestions.Set(ctx, userID, suggestions); err != nil {
+			app.logger.Error("error caching suggestions", "user_id", userID, "error", err)
+		}
+	}
+
+	return suggestions, nil
+}
+
+// invalidateSuggestions drops the cached suggestions of users whose follows,
+// blocks or mutes changed.
+func (app *application) invalidateSuggestions(ctx context.Context, userIDs ...int64) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	for _, id := range userIDs {
+		app.cacheStorage.Suggestions.Delete(ctx, id)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/internal/store/cache"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetSuggestions(t *testing.T) {
+	withRedis := config{
+		cache: cacheConfig{
+			enabled: true,
+		},
+	}
+
+	app := newTestApplication(t, withRedis)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.cacheStorage.Users.(*cache.MockUserStore).On("Get", int64(1)).Return(nil, nil)
+	app.cacheStorage.Users.(*cache.MockUserStore).On("Set", mock.Anything).Return(nil)
+
+	t.Run("should rank and cache the suggestions on a miss", func(t *testing.T) {
+		mockCacheStore := app.cacheStorage.Suggestions.(*cache.MockSuggestionStore)
+
+		mockCacheStore.On("Get", int64(1)).Return(nil, nil).Once()
+		mockCacheStore.On("Set", int64(1), mock.Anything).Return(nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/suggestions?limit=2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data []store.Suggestion `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(body.Data) != 2 {
+			t.Errorf("expected 2 suggestions, got %d", len(body.Data))
+		}
+
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should serve the cached suggestions", func(t *testing.T) {
+		mockCacheStore := app.cacheStorage.Suggestions.(*cache.MockSuggestionStore)
+		mockCacheStore.Calls = nil
+
+		mockCacheStore.On("Get", int64(1)).Return([]store.Suggestion{{ID: 7}}, nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/suggestions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		mockCacheStore.AssertNotCalled(t, "Set", mock.Anything, mock.Anything)
+	})
+
+	t.Run("should still return the suggestions when caching them fails", func(t *testing.T) {
+		mockCacheStore := app.cacheStorage.Suggestions.(*cache.MockSuggestionStore)
+
+		mockCacheStore.On("Get", int64(1)).Return(nil, nil).Once()
+		mockCacheStore.On("Set", int64(1), mock.Anything).Return(errors.New("cache unavailable")).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/suggestions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusOK, executeRequest(req, mux).Code)
+
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should rank the suggestions when the cache can't be read", func(t *testing.T) {
+		mockCacheStore := app.cacheStorage.Suggestions.(*cache.MockSuggestionStore)
+
+		mockCacheStore.On("Get", int64(1)).Return(nil, errors.New("cache unavailable")).Once()
+		mockCacheStore.On("Set", int64(1), mock.Anything).Return(nil).Once()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/suggestions", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusOK, executeRequest(req, mux).Code)
+
+		mockCacheStore.AssertExpectations(t)
+	})
+
+	t.Run("should reject invalid limits", func(t *testing.T) {
+		for _, limit := range []string{"0", "51", "ten"} {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/me/suggestions?limit="+limit, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+		}
+	})
+}
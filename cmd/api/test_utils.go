@@ -6,11 +6,15 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github/hassanharga/go-social/internal/auth"
-	// "github/hassanharga/go-social/internal/ratelimiter"
+	"github/hassanharga/go-social/internal/blob"
+	"github/hassanharga/go-social/internal/mailer"
+	"github/hassanharga/go-social/internal/ratelimiter"
 	"github/hassanharga/go-social/internal/store"
 	"github/hassanharga/go-social/internal/store/cache"
+	"github/hassanharga/go-social/internal/totp"
 )
 
 func newTestApplication(t *testing.T, cfg config) *application {
@@ -25,19 +29,33 @@ func newTestApplication(t *testing.T, cfg config) *application {
 
 	testAuth := &auth.TestAuthenticator{}
 
+	blobStorage, err := blob.NewLocal(t.TempDir(), "http://localhost/v1/files", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totpCipher, err := totp.NewCipher("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// Rate limiter
-	// rateLimiter := ratelimiter.NewFixedWindowLimiter(
-	// 	cfg.rateLimiter.RequestsPerTimeFrame,
-	// 	cfg.rateLimiter.TimeFrame,
-	// )
+	rateLimiter := ratelimiter.NewFixedWindowLimiter(
+		cfg.rateLimiter.RequestsPerTimeFrame,
+		cfg.rateLimiter.TimeFrame,
+	)
 
 	return &application{
-		logger:        logger,
-		store:         mockStore,
-		cacheStorage:  mockCacheStore,
-		authenticator: testAuth,
-		config:        cfg,
-		// rateLimiter:   rateLimiter,
+		logger:            logger,
+		store:             mockStore,
+		cacheStorage:      mockCacheStore,
+		authenticator:     testAuth,
+		config:            cfg,
+		rateLimiter:       rateLimiter,
+		activationLimiter: ratelimiter.NewFixedWindowLimiter(3, time.Hour),
+		blobStorage:       blobStorage,
+		mailer:            &mailer.MockMailer{},
+		totpCipher:        totpCipher,
 	}
 }
 
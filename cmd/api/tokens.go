@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type personalTokenKey string
+
+const personalTokenCtxKey personalTokenKey = "personalToken"
+
+// personalTokenPrefix tells personal access tokens apart from JWTs
+const personalTokenPrefix = "gsp_"
+
+type CreatePersonalTokenPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// days until the token expires, never when omitted
+	ExpiresIn int      `json:"expires_in" validate:"omitempty,min=1,max=365"`
+	Scopes    []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write comments:write follows:read follows:write feed:read users:read"`
+}
+
+type PersonalTokenWithSecret struct {
+	*store.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// createPersonalTokenHandler godoc
+//
+//	@Summary		Creates a personal access token
+//	@Description	Creates a scoped token for scripts and bots. The token is only returned once
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreatePersonalTokenPayload	true	"Token payload"
+//	@Success		201		{object}	PersonalTokenWithSecret
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/tokens [post]
+func (app *application) createPersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreatePersonalTokenPayload
+	if err := utils.ReadJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	plainToken, err := generatePersonalToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var expiry time.Time
+	if payload.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Hour * 24 * time.Duration(payload.ExpiresIn))
+	}
+
+	pat := &store.PersonalAccessToken{
+		UserID: user.ID,
+		Name:   payload.Name,
+		Scopes: payload.Scopes,
+	}
+
+	if err := app.store.PersonalTokens.Create(r.Context(), pat, plainToken, expiry); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, PersonalTokenWithSecret{PersonalAccessToken: pat, Token: plainToken}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listPersonalTokensHandler godoc
+//
+//	@Summary		Lists personal access tokens
+//	@Description	Lists the personal access tokens of the current user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	[]store.PersonalAccessToken
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/tokens [get]
+func (app *application) listPersonalTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+
+	tokens, err := app.store.PersonalTokens.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deletePersonalTokenHandler godoc
+//
+//	@Summary		Revokes a personal access token
+//	@Description	Revokes a personal access token of the current user
+//	@Tags			users
+//	@Produce		json
+//	@Param			tokenID	path		int		true	"Token ID"
+//	@Success		200		{string}	string	"Token revoked"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/tokens/{tokenID} [delete]
+func (app *application) deletePersonalTokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+
+	if err := app.store.PersonalTokens.Delete(r.Context(), user.ID, tokenID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "token revoked"}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func generatePersonalToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return personalTokenPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
+
+func getPersonalTokenFromCtx(r *http.Request) *store.PersonalAccessToken {
+	pat, ok := r.Context().Value(personalTokenCtxKey).(*store.PersonalAccessToken)
+	if !ok {
+		return nil
+	}
+	return pat
+}
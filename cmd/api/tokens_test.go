@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"github/hassanharga/go-social/internal/store"
+	"net/http"
+	"testing"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	// the mock store grants every personal token the posts:read scope only
+	token := personalTokenPrefix + "test"
+
+	t.Run("should authenticate personal access tokens", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/posts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should reject routes outside the token scopes", func(t *testing.T) {
+		for _, url := range []string{
+			"/v1/users/feed",
+			"/v1/users/1",
+			"/v1/users/1/followers",
+			"/v1/users/1/following",
+			"/v1/users/me/suggestions",
+			"/v1/users/search?q=test",
+		} {
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should not let personal access tokens manage tokens", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/tokens", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should revoke personal access tokens with the other tokens", func(t *testing.T) {
+		tokens := &personalTokenStore{}
+		app.store.PersonalTokens = tokens
+
+		testToken, err := app.authenticator.GenerateToken(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/1/tokens/revoke", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusOK, executeRequest(req, mux).Code)
+
+		if len(tokens.revokedUsers) != 1 || tokens.revokedUsers[0] != 1 {
+			t.Errorf("expected the personal tokens of user 1 to be revoked, got %v", tokens.revokedUsers)
+		}
+	})
+}
+
+// personalTokenStore records the users whose personal tokens were revoked.
+type personalTokenStore struct {
+	store.MockPersonalTokenStore
+	revokedUsers []int64
+}
+
+func (s *personalTokenStore) DeleteAll(ctx context.Context, userID int64) error {
+	s.revokedUsers = append(s.revokedUsers, userID)
+	return nil
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github/hassanharga/go-social/internal/blob"
+	"github/hassanharga/go-social/internal/imaging"
+	"github/hassanharga/go-social/internal/store"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// the multipart form field carrying the file
+const uploadFormField = "file"
+
+// avatars are stored in a single size
+var avatarSize = imaging.Size{Name: "avatar", MaxDimension: 512}
+
+var (
+	errFileTooLarge    = errors.New("file is too large")
+	errMissingFile     = errors.New("missing file, send it in the \"file\" field of a multipart form")
+	errUnsupportedFile = errors.New("unsupported file type")
+)
+
+// allowed content types, detected from the file content, and the extension
+// the blob is stored with
+var (
+	avatarContentTypes = map[string]string{
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+	}
+	attachmentContentTypes = map[string]string{
+		"image/jpeg":      ".jpg",
+		"image/png":       ".png",
+		"image/gif":       ".gif",
+		"image/webp":      ".webp",
+		"video/mp4":       ".mp4",
+		"application/pdf": ".pdf",
+	}
+)
+
+// uploadAvatarHandler godoc
+//
+//	@Summary		Uploads an avatar
+//	@Description	Stores a JPEG, PNG, GIF or WebP image sent as the "file" field of a multipart form and sets it as the avatar of the current user
+//	@Tags			users
+//	@Accept			mpfd
+//	@Produce		json
+//	@Param			file	formData	file	true	"Avatar image"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		413		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [put]
+func (app *application) uploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	upload, err := app.storeUpload(w, r, store.UploadKindAvatar, app.config.uploads.maxAvatarSize, avatarContentTypes)
+	if err != nil {
+		app.uploadError(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetById(ctx, upload.UserID)
+	if err != nil {
+		app.deleteUpload(ctx, upload.UserID, upload.ID)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	previousURL := user.AvatarURL
+	user.AvatarURL = app.avatarURL(upload.ID)
+
+	// the account stays as private or public as it was, no request is approved
+	if _, err := app.store.Users.Update(ctx, user); err != nil {
+		app.deleteUpload(ctx, upload.UserID, upload.ID)
+
+		switch err {
+		case store.ErrNotFound:
+			app.conflictError(w, r, errors.New("the user was modified, try again"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the replaced avatar is no longer referenced. Any URL can be set as the
+	// avatar, so only avatar uploads of the user are deleted
+	if previousID, ok := strings.CutPrefix(previousURL, app.avatarURL("")); ok {
+		previous, err := app.store.Uploads.GetByID(ctx, previousID)
+		if err == nil && previous.Kind == store.UploadKindAvatar {
+			app.deleteUpload(ctx, user.ID, previous.ID)
+		}
+	}
+
+	if app.config.cache.enabled {
+		app.cacheStorage.Users.Delete(ctx, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// avatarURL is the stable URL of an avatar upload, redirecting to a fresh
+// signed URL on every request.
+func (app *application) avatarURL(uploadID string) string {
+	return fmt.Sprintf("%s/v1/uploads/%s", app.config.publicURL, uploadID)
+}
+
+// uploadAttachmentHandler godoc
+//
+//	@Summary		Uploads a post attachment
+//	@Description	Stores an image, MP4 video or PDF sent as the "file" field of a multipart form
+//	@Tags			uploads
+//	@Accept			mpfd
+//	@Produce		json
+//	@Param			file	formData	file	true	"Attachment"
+//	@Success		201		{object}	store.Upload
+//	@Failure		400		{object}	error
+//	@Failure		413		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/uploads [post]
+func (app *application) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	upload, err := app.storeUpload(w, r, store.UploadKindAttachment, app.config.uploads.maxAttachmentSize, attachmentContentTypes)
+	if err != nil {
+		app.uploadError(w, r, err)
+		return
+	}
+
+	upload.URL, err = app.blobStorage.SignedURL(r.Context(), upload.Key, app.config.uploads.urlExpiry)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, upload); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getUploadHandler godoc
+//
+//	@Summary		Downloads an avatar
+//	@Description	Redirects to a short-lived signed URL of an avatar of the caller, or the current avatar of another user unless either blocked the other. The originals of post images are never served, only their processed variants
+//	@Tags			uploads
+//	@Param			uploadID	path	string	true	"Upload ID"
+//	@Success		302
+//	@Failure		401	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/uploads/{uploadID} [get]
+func (app *application) getUploadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "uploadID"))
+	if err != nil {
+		app.notFoundError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	upload, err := app.store.Uploads.GetByID(ctx, id.String())
+	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	visible, err := app.canSeeUpload(ctx, upload, getUserFromCtx(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// hidden uploads are reported as missing
+	if !visible {
+		app.notFoundError(w, r, errors.New("upload not found"))
+		return
+	}
+
+	signedURL, err := app.blobStorage.SignedURL(ctx, upload.Key, app.config.uploads.urlExpiry)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, signedURL, http.StatusFound)
+}
+
+// canSeeUpload reports whether the viewer can download the upload. Only
+// avatars are served: attachments are the originals of post images, which
+// may still hold metadata until they are processed.
+func (app *application) canSeeUpload(ctx context.Context, upload *store.Upload, viewerID int64) (bool, error) {
+	if upload.Kind != store.UploadKindAvatar {
+		return false, nil
+	}
+
+	if upload.UserID == viewerID {
+		return true, nil
+	}
+
+	owner, err := app.getUser(ctx, upload.UserID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if owner.AvatarURL != app.avatarURL(upload.ID) {
+		return false, nil
+	}
+
+	blocked, err := app.store.Blocks.IsBlocked(ctx, viewerID, owner.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return !blocked, nil
+}
+
+// serveFileHandler godoc
+//
+//	@Summary		Serves a file of the local blob storage
+//	@Description	Only available with the local backend, through the signed URLs it generates
+//	@Tags			uploads
+//	@Param			expires		query	int		true	"Expiry as a unix timestamp"
+//	@Param			signature	query	string	true	"URL signature"
+//	@Success		200
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Router			/files/{key} [get]
+func (app *application) serveFileHandler(w http.ResponseWriter, r *http.Request) {
+	verifier, ok := app.blobStorage.(blob.URLVerifier)
+	if !ok {
+		app.notFoundError(w, r, errors.New("files are not served by the api"))
+		return
+	}
+
+	key := chi.URLParam(r, "*")
+
+	if err := verifier.Verify(key, r.URL.Query()); err != nil {
+		app.forbiddenError(w, r)
+		return
+	}
+
+	body, err := app.blobStorage.Get(r.Context(), key)
+	if err != nil {
+		switch err {
+		case blob.ErrNotFound, blob.ErrInvalidKey:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer body.Close()
+
+	// keys end with the extension of their detected content type
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+
+	if _, err := io.Copy(w, body); err != nil {
+		app.logger.Warn("error serving file", "key", key, "error", err)
+	}
+}
+
+// storeUpload reads the file of a multipart upload, checks its size and
+// detected content type, and saves it to the blob storage.
+func (app *application) storeUpload(w http.ResponseWriter, r *http.Request, kind string, maxSize int64, contentTypes map[string]string) (*store.Upload, error) {
+	data, err := readUploadedFile(w, r, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// the declared content type is not trusted
+	contentType := http.DetectContentType(data)
+	ext, ok := contentTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedFile, contentType)
+	}
+
+	// avatars are shown to everyone as uploaded, so they are re-encoded to
+	// strip their metadata
+	if kind == store.UploadKindAvatar {
+		result, err := imaging.Process(data, []imaging.Size{avatarSize})
+		if err != nil {
+			switch err {
+			case imaging.ErrUnsupportedFormat, imaging.ErrTooLarge:
+				return nil, fmt.Errorf("%w: %s", errUnsupportedFile, err)
+			default:
+				return nil, err
+			}
+		}
+
+		avatar := result.Variants[0]
+		data, contentType, ext = avatar.Data, avatar.ContentType, avatar.Ext
+	}
+
+	user := getUserFromCtx(r)
+	id := uuid.New().String()
+
+	upload := &store.Upload{
+		ID:          id,
+		UserID:      user.ID,
+		Kind:        kind,
+		Key:         fmt.Sprintf("%ss/%d/%s%s", kind, user.ID, id, ext),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+	}
+
+	ctx := r.Context()
+
+	if err := app.blobStorage.Put(ctx, upload.Key, bytes.NewReader(data), upload.Size, contentType); err != nil {
+		return nil, err
+	}
+
+	if err := app.store.Uploads.Create(ctx, upload); err != nil {
+		app.deleteBlob(upload.Key)
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func readUploadedFile(w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, error) {
+	// leave room for the multipart headers and boundaries
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, errMissingFile
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errMissingFile
+		}
+		if err != nil {
+			return nil, tooLargeOr(err)
+		}
+
+		if part.FormName() != uploadFormField {
+			part.Close()
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		part.Close()
+		if err != nil {
+			return nil, tooLargeOr(err)
+		}
+
+		if int64(len(data)) > maxSize {
+			return nil, errFileTooLarge
+		}
+
+		if len(data) == 0 {
+			return nil, errMissingFile
+		}
+
+		return data, nil
+	}
+}
+
+func tooLargeOr(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errFileTooLarge
+	}
+
+	return err
+}
+
+func (app *application) uploadError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errFileTooLarge):
+		app.payloadTooLargeError(w, r, err)
+	case errors.Is(err, errMissingFile), errors.Is(err, errUnsupportedFile):
+		app.badRequestError(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteUpload removes an upload of the user that is no longer referenced,
+// with its blob. Failures only leave an orphaned upload behind, so they are
+// logged.
+func (app *application) deleteUpload(ctx context.Context, userID int64, uploadID string) {
+	key, err := app.store.Uploads.Delete(ctx, userID, uploadID)
+	if err != nil {
+		if err != store.ErrNotFound {
+			app.logger.Error("error deleting upload", "upload_id", uploadID, "error", err)
+		}
+		return
+	}
+
+	app.deleteBlob(key)
+}
+
+// deleteBlob removes a blob that is no longer referenced. Failures only leave
+// an orphaned file behind, so they are logged.
+func (app *application) deleteBlob(key string) {
+	if err := app.blobStorage.Delete(context.Background(), key); err != nil {
+		app.logger.Error("error deleting blob", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github/hassanharga/go-social/internal/store"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+// pngHeader is enough for content type detection
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// pngImage is a decodable image, for avatars which are re-encoded
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newUploadRequest(t *testing.T, method, target string, data []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile(uploadFormField, "file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	writer.Close()
+
+	req, err := http.NewRequest(method, target, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return req
+}
+
+func TestUploads(t *testing.T) {
+	app := newTestApplication(t, config{
+		uploads: uploadConfig{
+			urlExpiry:         time.Minute,
+			maxAvatarSize:     1 << 10,
+			maxAttachmentSize: 1 << 10,
+		},
+	})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should store an attachment and serve it from its signed URL", func(t *testing.T) {
+		req := newUploadRequest(t, http.MethodPost, "/v1/uploads", pngHeader)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var body struct {
+			Data struct {
+				ContentType string `json:"content_type"`
+				URL         string `json:"url"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if body.Data.ContentType != "image/png" {
+			t.Errorf("expected the detected content type image/png, got %q", body.Data.ContentType)
+		}
+
+		signed, err := url.Parse(body.Data.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err = http.NewRequest(http.MethodGet, signed.RequestURI(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		if !bytes.Equal(rr.Body.Bytes(), pngHeader) {
+			t.Error("expected the served file to match the upload")
+		}
+
+		// the signature is bound to the key
+		tampered := signed.Query()
+		tampered.Set("expires", "9999999999")
+
+		req, err = http.NewRequest(http.MethodGet, signed.Path+"?"+tampered.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusForbidden, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should reject unsupported content types", func(t *testing.T) {
+		req := newUploadRequest(t, http.MethodPost, "/v1/uploads", []byte("#!/bin/sh\necho hello"))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should reject files over the size limit", func(t *testing.T) {
+		req := newUploadRequest(t, http.MethodPost, "/v1/uploads", append(pngHeader, make([]byte, 2<<10)...))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusRequestEntityTooLarge, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should set the avatar of the current user", func(t *testing.T) {
+		req := newUploadRequest(t, http.MethodPut, "/v1/users/me/avatar", pngImage(t))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusOK, executeRequest(req, mux).Code)
+	})
+}
+
+// uploadStore keeps the uploads in memory and records the deleted ones.
+type uploadStore struct {
+	store.MockUploadStore
+	uploads map[string]*store.Upload
+	deleted []string
+}
+
+func (s *uploadStore) Create(ctx context.Context, upload *store.Upload) error {
+	s.uploads[upload.ID] = upload
+	return nil
+}
+
+func (s *uploadStore) GetByID(ctx context.Context, id string) (*store.Upload, error) {
+	upload, ok := s.uploads[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return upload, nil
+}
+
+func (s *uploadStore) Delete(ctx context.Context, userID int64, id string) (string, error) {
+	upload, ok := s.uploads[id]
+	if !ok || upload.UserID != userID {
+		return "", store.ErrNotFound
+	}
+	delete(s.uploads, id)
+	s.deleted = append(s.deleted, id)
+	return upload.Key, nil
+}
+
+// avatarStore keeps the avatar URLs of the users, and fails updates when
+// told to.
+type avatarStore struct {
+	store.MockUserStore
+	avatars    map[int64]string
+	failUpdate bool
+}
+
+func (s *avatarStore) GetById(ctx context.Context, userID int64) (*store.User, error) {
+	return &store.User{ID: userID, UserProfile: store.UserProfile{AvatarURL: s.avatars[userID]}}, nil
+}
+
+func (s *avatarStore) Update(ctx context.Context, user *store.User) ([]int64, error) {
+	if s.failUpdate {
+		return nil, errors.New("update failed")
+	}
+	s.avatars[user.ID] = user.AvatarURL
+	return nil, nil
+}
+
+func TestAvatars(t *testing.T) {
+	app := newTestApplication(t, config{
+		publicURL: "http://localhost",
+		uploads: uploadConfig{
+			urlExpiry:     time.Minute,
+			maxAvatarSize: 1 << 10,
+		},
+	})
+	mux := app.mount()
+
+	uploads := &uploadStore{uploads: make(map[string]*store.Upload)}
+	users := &avatarStore{avatars: make(map[int64]string)}
+	app.store.Uploads = uploads
+	app.store.Users = users
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setAvatar := func(t *testing.T) int {
+		req := newUploadRequest(t, http.MethodPut, "/v1/users/me/avatar", pngImage(t))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Code
+	}
+
+	get := func(t *testing.T, id string, authenticated bool) int {
+		req, err := http.NewRequest(http.MethodGet, "/v1/uploads/"+id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authenticated {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+
+		return executeRequest(req, mux).Code
+	}
+
+	// other users' uploads
+	const (
+		avatarID   = "0b8a5f4e-1c2d-4e3f-8a9b-1c2d3e4f5a6b"
+		oldID      = "1c9b6a5f-2d3e-4f4a-9b0c-2d3e4f5a6b7c"
+		blockedID  = "2d0c7b6a-3e4f-4a5b-8c1d-3e4f5a6b7c8d"
+		originalID = "3e1d8c7b-4f5a-4b6c-9d2e-4f5a6b7c8d9e"
+	)
+	uploads.uploads[avatarID] = &store.Upload{ID: avatarID, UserID: 2, Kind: store.UploadKindAvatar, Key: "avatars/2/a.png"}
+	uploads.uploads[oldID] = &store.Upload{ID: oldID, UserID: 2, Kind: store.UploadKindAvatar, Key: "avatars/2/b.png"}
+	uploads.uploads[blockedID] = &store.Upload{ID: blockedID, UserID: 4, Kind: store.UploadKindAvatar, Key: "avatars/4/a.png"}
+	uploads.uploads[originalID] = &store.Upload{ID: originalID, UserID: 1, Kind: store.UploadKindAttachment, Key: "attachments/1/a.png"}
+	users.avatars[2] = app.avatarURL(avatarID)
+	users.avatars[4] = app.avatarURL(blockedID)
+
+	var first string
+
+	t.Run("should replace the avatar and delete the previous one", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, setAvatar(t))
+		first = users.avatars[1]
+
+		checkResponseCode(t, http.StatusOK, setAvatar(t))
+
+		firstID := first[len(app.avatarURL("")):]
+		if users.avatars[1] == first || !slices.Contains(uploads.deleted, firstID) {
+			t.Errorf("expected the previous avatar %s to be deleted, got %v", firstID, uploads.deleted)
+		}
+	})
+
+	t.Run("should delete the new avatar when it can't be set", func(t *testing.T) {
+		users.failUpdate = true
+		defer func() { users.failUpdate = false }()
+
+		deleted := len(uploads.deleted)
+		checkResponseCode(t, http.StatusInternalServerError, setAvatar(t))
+
+		if len(uploads.deleted) != deleted+1 {
+			t.Errorf("expected the new avatar to be deleted, got %v", uploads.deleted)
+		}
+	})
+
+	t.Run("should require authentication", func(t *testing.T) {
+		checkResponseCode(t, http.StatusUnauthorized, get(t, avatarID, false))
+	})
+
+	t.Run("should serve the own avatar", func(t *testing.T) {
+		checkResponseCode(t, http.StatusFound, get(t, users.avatars[1][len(app.avatarURL("")):], true))
+	})
+
+	t.Run("should serve the current avatar of other users", func(t *testing.T) {
+		checkResponseCode(t, http.StatusFound, get(t, avatarID, true))
+	})
+
+	t.Run("should not serve replaced avatars of other users", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, get(t, oldID, true))
+	})
+
+	t.Run("should not serve avatars across blocks", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, get(t, blockedID, true))
+	})
+
+	t.Run("should never serve post image originals", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, get(t, originalID, true))
+	})
+}
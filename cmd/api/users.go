@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github/hassanharga/go-social/internal/store"
+	"github/hassanharga/go-social/utils"
 	"net/http"
 	"strconv"
 
@@ -25,7 +27,7 @@ type FollowedUser struct {
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	store.User
+//	@Success		200	{object}	store.PublicUser
 //	@Failure		400	{object}	error
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
@@ -50,7 +52,48 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, user.Public()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// searchUsersHandler godoc
+//
+//	@Summary		Searches users
+//	@Description	Finds active users by username or display name, by prefix or similarity. Exact usernames come first, then prefixes, then similar names, with the users the caller follows first within each
+//	@Tags			users
+//	@Produce		json
+//	@Param			q		query		string	true	"Search"
+//	@Param			limit	query		int		false	"Page size, up to 50"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.UserSearchResult
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/search [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	sq := store.UserSearchQuery{
+		Limit: 20,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(sq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	users, err := app.store.Users.Search(r.Context(), getUserFromCtx(r).ID, sq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -58,14 +101,17 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 // FollowUser godoc
 //
 //	@Summary		Follows a user
-//	@Description	Follows a user by ID
+//	@Description	Follows a user by ID. Following a private account sends a follow request its owner has to approve
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int		true	"User ID"
 //	@Success		204	{string}	string	"User followed"
-//	@Failure		400	{object}	error	"User payload missing"
+//	@Success		202	{string}	string	"Follow request sent"
+//	@Failure		400	{object}	error	"Following yourself"
+//	@Failure		403	{object}	error	"One of the users blocked the other"
 //	@Failure		404	{object}	error	"User not found"
+//	@Failure		409	{object}	error	"Already following or requested to follow the user"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{id}/follow [put]
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -78,16 +124,45 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	ctx := r.Context()
-	err = app.store.Followers.Follow(ctx, followerUser.ID, followedId)
+
+	// blocked users can't follow each other
+	blocked, err := app.store.Blocks.IsBlocked(ctx, followerUser.ID, followedId)
 	if err != nil {
-		if errors.Is(err, store.ErrConflict) {
-			app.conflictError(w, r, err)
-			return
-		}
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	if blocked {
+		app.forbiddenError(w, r)
+		return
+	}
+
+	requested, err := app.store.Followers.Follow(ctx, followerUser.ID, followedId)
+	if err != nil {
+		switch err {
+		case store.ErrSelfFollow:
+			app.badRequestError(w, r, err)
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		case store.ErrConflict:
+			app.conflictError(w, r, errors.New("already following or requested to follow the user"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateSuggestions(ctx, followerUser.ID)
+
+	if requested {
+		if err := app.jsonResponse(w, http.StatusAccepted, map[string]string{"message": "follow request sent"}); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateFollowCounts(ctx, followerUser.ID, followedId)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -96,14 +171,15 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 // UnfollowUser gdoc
 //
 //	@Summary		Unfollow a user
-//	@Description	Unfollow a user by ID
+//	@Description	Unfollow a user by ID, or cancel the pending request to follow them
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int		true	"User ID"
 //	@Success		204	{string}	string	"User unfollowed"
-//	@Failure		400	{object}	error	"User payload missing"
+//	@Failure		400	{object}	error	"Invalid user ID"
 //	@Failure		404	{object}	error	"User not found"
+//	@Failure		409	{object}	error	"Not following the user"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{id}/unfollow [put]
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -118,12 +194,108 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 	ctx := r.Context()
 	err = app.store.Followers.Unfollow(ctx, followerUser.ID, followedId)
 	if err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		case store.ErrNotFollowing:
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateFollowCounts(ctx, followerUser.ID, followedId)
+	app.invalidateSuggestions(ctx, followerUser.ID)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetFollowers godoc
+//
+//	@Summary		Lists the followers of a user
+//	@Description	Lists the users following a user, newest first, with their relation to the caller. Pass the returned next_cursor to fetch the next page. With mutual=true only the followers the user follows back are listed
+//	@Tags			users
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Page size, up to 100"
+//	@Param			cursor	query		string	false	"Cursor of the next page"
+//	@Param			mutual	query		bool	false	"Only mutual follows"
+//	@Success		200		{object}	store.FollowPage
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/followers [get]
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.followList(w, r, app.store.Followers.GetFollowers)
+}
+
+// GetFollowing godoc
+//
+//	@Summary		Lists the users a user follows
+//	@Description	Lists the users followed by a user, newest first, with their relation to the caller. Pass the returned next_cursor to fetch the next page. With mutual=true only the users following the user back are listed
+//	@Tags			users
+//	@Produce		json
+//	@Param			id		path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Page size, up to 100"
+//	@Param			cursor	query		string	false	"Cursor of the next page"
+//	@Param			mutual	query		bool	false	"Only mutual follows"
+//	@Success		200		{object}	store.FollowPage
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{id}/following [get]
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.followList(w, r, app.store.Followers.GetFollowing)
+}
+
+type followListFunc func(ctx context.Context, userID, viewerID int64, fq store.PaginatedFollowQuery) (*store.FollowPage, error)
+
+func (app *application) followList(w http.ResponseWriter, r *http.Request, list followListFunc) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	fq := store.PaginatedFollowQuery{
+		Limit: 20,
+	}
+
+	fq, err = fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if _, err := app.getUser(ctx, userID); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
 
+	page, err := list(ctx, userID, getUserFromCtx(r).ID, fq)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -159,6 +331,17 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 // 	})
 // }
 
+// invalidateFollowCounts drops the cached users whose follow counts changed.
+func (app *application) invalidateFollowCounts(ctx context.Context, userIDs ...int64) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	for _, id := range userIDs {
+		app.cacheStorage.Users.Delete(ctx, id)
+	}
+}
+
 func getUserFromCtx(r *http.Request) *store.User {
 	user, ok := r.Context().Value(userCtxKey).(*store.User)
 	if !ok {
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"github/hassanharga/go-social/internal/store"
 	"github/hassanharga/go-social/internal/store/cache"
 	"net/http"
 	"testing"
@@ -105,3 +107,248 @@ func TestGetUser(t *testing.T) {
 		mockCacheStore.Calls = nil // Reset mock expectations
 	})
 }
+
+func TestGetUserProfile(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not expose the email", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := body.Data["email"]; ok {
+			t.Error("expected the public profile to omit the email")
+		}
+
+		if _, ok := body.Data["stats"]; !ok {
+			t.Error("expected the public profile to include the stats")
+		}
+	})
+}
+
+func TestFollowLists(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should list the followers with their relation to the caller", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1/followers?limit=10&mutual=true", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data struct {
+				Users []map[string]any `json:"users"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(body.Data.Users) != 1 || body.Data.Users[0]["you_follow"] != true {
+			t.Errorf("unexpected followers %v", body.Data.Users)
+		}
+	})
+
+	t.Run("should reject invalid pages", func(t *testing.T) {
+		for _, query := range []string{"cursor=not-a-cursor", "limit=1000", "mutual=maybe"} {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/1/following?"+query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+		}
+	})
+}
+
+func TestFollow(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"should follow another user", "/v1/users/2/follow", http.StatusNoContent},
+		{"should not follow yourself", "/v1/users/1/follow", http.StatusBadRequest},
+		{"should unfollow a followed user", "/v1/users/2/unfollow", http.StatusNoContent},
+		{"should not unfollow a user that is not followed", "/v1/users/3/unfollow", http.StatusConflict},
+		{"should request to follow a private account", "/v1/users/3/follow", http.StatusAccepted},
+		{"should reject a follow request", "/v1/users/me/follow-requests/3/reject", http.StatusNoContent},
+		{"should not approve a missing follow request", "/v1/users/me/follow-requests/4/approve", http.StatusNotFound},
+		{"should not follow a blocked user", "/v1/users/4/follow", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPut, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, tt.status, executeRequest(req, mux).Code)
+		})
+	}
+}
+
+func TestFollowRequests(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/me/follow-requests?limit=5", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	rr := executeRequest(req, mux)
+
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var body struct {
+		Data store.FollowRequestPage `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Data.Requests) != 1 || body.Data.Requests[0].ID != 3 {
+		t.Errorf("unexpected follow requests %v", body.Data.Requests)
+	}
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"should block a user", http.MethodPut, "/v1/users/2/block", http.StatusNoContent},
+		{"should not block yourself", http.MethodPut, "/v1/users/1/block", http.StatusBadRequest},
+		{"should not block a user twice", http.MethodPut, "/v1/users/4/block", http.StatusConflict},
+		{"should list the blocked users", http.MethodGet, "/v1/users/me/blocks", http.StatusOK},
+		{"should unblock a blocked user", http.MethodDelete, "/v1/users/me/blocks/4", http.StatusNoContent},
+		{"should not unblock a user that is not blocked", http.MethodDelete, "/v1/users/me/blocks/2", http.StatusNotFound},
+		{"should mute a user", http.MethodPut, "/v1/users/2/mute", http.StatusNoContent},
+		{"should not mute yourself", http.MethodPut, "/v1/users/1/mute", http.StatusBadRequest},
+		{"should list the muted users", http.MethodGet, "/v1/users/me/mutes?limit=5", http.StatusOK},
+		{"should not unmute a user that is not muted", http.MethodDelete, "/v1/users/me/mutes/2", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, tt.status, executeRequest(req, mux).Code)
+		})
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should search users", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/search?q=+jo+&limit=5&offset=5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data []store.UserSearchResult `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(body.Data) != 1 || body.Data[0].Username != "jo" {
+			t.Errorf("unexpected results %v", body.Data)
+		}
+	})
+
+	t.Run("should reject invalid searches", func(t *testing.T) {
+		for _, query := range []string{"", "q=", "q=jo&limit=100", "q=jo&offset=-1", "q=jo&limit=many"} {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/search?"+query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+		}
+	})
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS session_rotated_tokens;
+
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS sessions (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  token bytea UNIQUE NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL,
+  revoked BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- refresh tokens that were already rotated out of a session, kept to detect reuse
+CREATE TABLE IF NOT EXISTS session_rotated_tokens (
+  token bytea PRIMARY KEY,
+  session_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE
+  users DROP COLUMN tokens_revoked_at;
+
+DROP TABLE IF EXISTS revoked_tokens;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti varchar(36) PRIMARY KEY,
+  user_id bigint NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE
+  users
+ADD
+  COLUMN tokens_revoked_at timestamp(0) with time zone;
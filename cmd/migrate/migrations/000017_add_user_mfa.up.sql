@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+  user_id bigint PRIMARY KEY,
+  -- TOTP shared secret, encrypted by the API before it is stored
+  secret bytea NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  last_used_step bigint NOT NULL DEFAULT 0,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  code bytea NOT NULL,
+  used_at timestamp(0) with time zone,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes (user_id);
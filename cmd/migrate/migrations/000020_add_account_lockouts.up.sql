@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS account_lockouts (
+  user_id bigint PRIMARY KEY,
+  -- consecutive failed logins since the last success or lockout
+  failed_attempts int NOT NULL DEFAULT 0,
+  -- lockouts since the last successful login, doubles the lock duration
+  lockouts int NOT NULL DEFAULT 0,
+  locked_until timestamp(0) with time zone,
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS email_changes;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS version;
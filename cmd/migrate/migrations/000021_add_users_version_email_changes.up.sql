@@ -0,0 +1,11 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS email_changes (
+  token bytea PRIMARY KEY,
+  user_id bigint NOT NULL,
+  new_email citext NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_followers_follower_id;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS display_name,
+DROP COLUMN IF EXISTS bio,
+DROP COLUMN IF EXISTS location,
+DROP COLUMN IF EXISTS website,
+DROP COLUMN IF EXISTS avatar_url;
@@ -0,0 +1,9 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS display_name varchar(100) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS bio varchar(500) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS location varchar(100) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS website varchar(255) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS avatar_url varchar(255) NOT NULL DEFAULT '';
+
+-- followers are counted by user_id through the primary key, following by follower_id
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
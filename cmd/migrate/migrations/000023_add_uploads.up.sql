@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS uploads (
+  -- random so upload URLs can not be enumerated
+  id uuid PRIMARY KEY,
+  user_id bigint NOT NULL,
+  kind varchar(20) NOT NULL,
+  -- location in the blob storage
+  key text NOT NULL,
+  content_type varchar(100) NOT NULL,
+  size bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_user_id ON uploads (user_id);
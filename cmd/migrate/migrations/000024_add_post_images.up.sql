@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS post_images (
+  id bigserial PRIMARY KEY,
+  post_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  -- the original upload, deleted once processed, so it belongs to one post
+  upload_id uuid NOT NULL UNIQUE,
+  source_key text NOT NULL,
+  position int NOT NULL DEFAULT 0,
+  -- pending, processing, ready or failed
+  status varchar(20) NOT NULL DEFAULT 'pending',
+  width int NOT NULL DEFAULT 0,
+  height int NOT NULL DEFAULT 0,
+  blurhash varchar(100) NOT NULL DEFAULT '',
+  -- blob keys of the generated variants by size name
+  variants jsonb NOT NULL DEFAULT '{}',
+  error text NOT NULL DEFAULT '',
+  attempts int NOT NULL DEFAULT 0,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_images_post_id ON post_images (post_id, position);
+
+CREATE INDEX IF NOT EXISTS idx_post_images_unprocessed ON post_images (updated_at)
+WHERE status IN ('pending', 'processing');
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS attachments (
+  id bigserial PRIMARY KEY,
+  post_id bigint NOT NULL,
+  -- image, video or file
+  type varchar(20) NOT NULL,
+  -- location in the blob storage
+  key text NOT NULL,
+  content_type varchar(100) NOT NULL,
+  size bigint NOT NULL,
+  -- zero when the file has no dimensions
+  width int NOT NULL DEFAULT 0,
+  height int NOT NULL DEFAULT 0,
+  alt_text varchar(500) NOT NULL DEFAULT '',
+  position int NOT NULL DEFAULT 0,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments (post_id, position);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS data_exports (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  -- pending, ready or failed
+  status varchar(20) NOT NULL DEFAULT 'pending',
+  -- hash of the download token sent by email
+  token text NOT NULL UNIQUE,
+  -- location of the archive in the blob storage
+  key text NOT NULL DEFAULT '',
+  size bigint NOT NULL DEFAULT 0,
+  error text NOT NULL DEFAULT '',
+  expires_at timestamp(0) with time zone NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  completed_at timestamp(0) with time zone,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- a single export is prepared at a time per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_pending ON data_exports (user_id)
+WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_expires_at ON data_exports (expires_at);
@@ -0,0 +1,12 @@
+-- anonymized content goes with the tombstone user
+DELETE FROM comments WHERE user_id IN (SELECT id FROM users WHERE is_tombstone);
+DELETE FROM posts WHERE user_id IN (SELECT id FROM users WHERE is_tombstone);
+DELETE FROM users WHERE is_tombstone;
+
+ALTER TABLE comments
+  DROP CONSTRAINT IF EXISTS fk_comments_post,
+  DROP CONSTRAINT IF EXISTS fk_comments_user;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_tombstone;
+
+DROP TABLE IF EXISTS account_deletions;
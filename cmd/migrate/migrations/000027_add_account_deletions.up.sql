@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS account_deletions (
+  user_id bigint PRIMARY KEY,
+  -- "delete" removes the posts and comments of the user, "anonymize"
+  -- reassigns them to the tombstone user
+  mode varchar(20) NOT NULL,
+  requested_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  scheduled_at timestamp(0) with time zone NOT NULL,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_deletions_scheduled_at ON account_deletions (scheduled_at);
+
+-- the "deleted user" owning anonymized content, it can not sign in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_tombstone boolean NOT NULL DEFAULT false;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tombstone ON users (is_tombstone) WHERE is_tombstone;
+
+INSERT INTO users (email, username, password, is_active, role_id, display_name, is_tombstone)
+SELECT
+  'tombstone-' || md5(random()::text) || '@deleted.invalid',
+  CASE
+    WHEN EXISTS (SELECT 1 FROM users WHERE username = '[deleted]')
+    THEN '[deleted]-' || substr(md5(random()::text), 1, 8)
+    ELSE '[deleted]'
+  END,
+  '',
+  false,
+  (SELECT id FROM roles WHERE name = 'user'),
+  'Deleted user',
+  true
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE is_tombstone);
+
+-- comments are removed together with their post and their author
+DELETE FROM comments WHERE post_id NOT IN (SELECT id FROM posts);
+DELETE FROM comments WHERE user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE comments
+  ADD CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+  ADD CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users (id);
@@ -0,0 +1,7 @@
+-- keyset pagination of the followers and following lists, newest first
+CREATE INDEX IF NOT EXISTS idx_followers_user_id_created_at ON followers (user_id, created_at DESC, follower_id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id_created_at ON followers (follower_id, created_at DESC, user_id DESC);
+
+-- superseded by the index above
+DROP INDEX IF EXISTS idx_followers_follower_id;
@@ -0,0 +1,6 @@
+ALTER TABLE followers
+DROP CONSTRAINT IF EXISTS followers_no_self_follow;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS following_count,
+DROP COLUMN IF EXISTS followers_count;
@@ -0,0 +1,14 @@
+-- self follows were never meant to be allowed
+DELETE FROM followers WHERE user_id = follower_id;
+
+ALTER TABLE followers
+ADD CONSTRAINT followers_no_self_follow CHECK (user_id <> follower_id);
+
+-- maintained by the follower store in the same transaction as the follow
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS followers_count bigint NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS following_count bigint NOT NULL DEFAULT 0;
+
+UPDATE users u
+SET followers_count = (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id),
+    following_count = (SELECT COUNT(*) FROM followers f WHERE f.follower_id = u.id);
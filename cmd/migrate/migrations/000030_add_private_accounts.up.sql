@@ -0,0 +1,19 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS is_private boolean NOT NULL DEFAULT false;
+
+-- follows of private accounts wait here until the owner approves them
+CREATE TABLE IF NOT EXISTS follow_requests (
+  user_id bigint NOT NULL,
+  requester_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, requester_id),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (requester_id) REFERENCES users (id) ON DELETE CASCADE,
+  CHECK (user_id <> requester_id)
+);
+
+-- pending requests are listed newest first
+CREATE INDEX IF NOT EXISTS idx_follow_requests_user_id_created_at ON follow_requests (user_id, created_at DESC, requester_id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_follow_requests_requester_id ON follow_requests (requester_id);
@@ -0,0 +1,30 @@
+-- blocked users are cut off from each other in both directions
+CREATE TABLE IF NOT EXISTS user_blocks (
+  blocker_id bigint NOT NULL,
+  blocked_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (blocker_id, blocked_id),
+  FOREIGN KEY (blocker_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (blocked_id) REFERENCES users (id) ON DELETE CASCADE,
+  CHECK (blocker_id <> blocked_id)
+);
+
+-- blocks are looked up from both sides
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked_id ON user_blocks (blocked_id);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocker_id_created_at ON user_blocks (blocker_id, created_at DESC, blocked_id DESC);
+
+-- muted users are only hidden from the feed of the muter
+CREATE TABLE IF NOT EXISTS user_mutes (
+  muter_id bigint NOT NULL,
+  muted_id bigint NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (muter_id, muted_id),
+  FOREIGN KEY (muter_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (muted_id) REFERENCES users (id) ON DELETE CASCADE,
+  CHECK (muter_id <> muted_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_mutes_muter_id_created_at ON user_mutes (muter_id, created_at DESC, muted_id DESC);
@@ -0,0 +1,2 @@
+-- the most followed users are suggested to everyone
+CREATE INDEX IF NOT EXISTS idx_users_followers_count ON users (followers_count DESC) WHERE is_active = true AND is_tombstone = false;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_display_name_lower_trgm;
+
+DROP INDEX IF EXISTS idx_users_username_lower_trgm;
+
+DROP INDEX IF EXISTS idx_users_username_lower_prefix;
@@ -0,0 +1,6 @@
+-- user search matches prefixes and similar names case-insensitively
+CREATE INDEX IF NOT EXISTS idx_users_username_lower_prefix ON users (lower(username) text_pattern_ops);
+
+CREATE INDEX IF NOT EXISTS idx_users_username_lower_trgm ON users USING gin (lower(username) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_users_display_name_lower_trgm ON users USING gin (lower(display_name) gin_trgm_ops);
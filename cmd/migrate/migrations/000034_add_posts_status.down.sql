@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_posts_user_id_unpublished;
+
+DROP INDEX IF EXISTS idx_posts_publish_at;
+
+ALTER TABLE posts
+DROP CONSTRAINT IF EXISTS posts_published_at_check,
+DROP CONSTRAINT IF EXISTS posts_scheduled_publish_at_check,
+DROP CONSTRAINT IF EXISTS posts_status_check,
+DROP COLUMN IF EXISTS published_at,
+DROP COLUMN IF EXISTS publish_at,
+DROP COLUMN IF EXISTS status;
@@ -0,0 +1,17 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS status varchar(20) NOT NULL DEFAULT 'published',
+ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone,
+ADD COLUMN IF NOT EXISTS published_at timestamp(0) with time zone;
+
+UPDATE posts SET published_at = created_at;
+
+ALTER TABLE posts
+ADD CONSTRAINT posts_status_check CHECK (status IN ('draft', 'scheduled', 'published')),
+ADD CONSTRAINT posts_scheduled_publish_at_check CHECK (status <> 'scheduled' OR publish_at IS NOT NULL),
+ADD CONSTRAINT posts_published_at_check CHECK (status <> 'published' OR published_at IS NOT NULL);
+
+-- the scheduler picks the due posts
+CREATE INDEX IF NOT EXISTS idx_posts_publish_at ON posts (publish_at) WHERE status = 'scheduled';
+
+-- drafts of a user
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_unpublished ON posts (user_id) WHERE status <> 'published';
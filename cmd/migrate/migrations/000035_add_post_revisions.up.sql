@@ -0,0 +1,14 @@
+-- the title and content of a post before each edit
+CREATE TABLE IF NOT EXISTS post_revisions (
+  id bigserial PRIMARY KEY,
+  post_id bigint NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+  version int NOT NULL,
+  title text NOT NULL,
+  content text NOT NULL,
+  edited_by bigint REFERENCES users (id) ON DELETE SET NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  UNIQUE (post_id, version)
+);
+
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS edited_at timestamp(0) with time zone;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_revoked_tokens_expiry;
@@ -0,0 +1,2 @@
+-- expired revocations are purged periodically
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expiry ON revoked_tokens (expiry);
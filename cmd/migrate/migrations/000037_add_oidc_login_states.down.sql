@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS identity_link_requests;
+
+DROP TABLE IF EXISTS oidc_login_states;
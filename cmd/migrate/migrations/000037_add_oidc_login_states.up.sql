@@ -0,0 +1,24 @@
+-- the PKCE verifier and nonce of a login stay on the server
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+  state bytea PRIMARY KEY,
+  provider varchar(50) NOT NULL,
+  nonce text NOT NULL,
+  verifier text NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expiry ON oidc_login_states (expiry);
+
+-- identities matching the email of an account wait for its owner to confirm
+CREATE TABLE IF NOT EXISTS identity_link_requests (
+  token bytea PRIMARY KEY,
+  user_id bigint NOT NULL,
+  provider varchar(50) NOT NULL,
+  subject varchar(255) NOT NULL,
+  email citext,
+  expiry timestamp(0) with time zone NOT NULL,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_identity_link_requests_expiry ON identity_link_requests (expiry);
@@ -0,0 +1,7 @@
+-- published posts, maintained by the post store in the same transaction as
+-- the post
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS posts_count bigint NOT NULL DEFAULT 0;
+
+UPDATE users u
+SET posts_count = (SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id AND p.status = 'published');
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_data_exports_claimed_at;
+
+DELETE FROM data_exports WHERE token IS NULL;
+
+ALTER TABLE data_exports
+DROP COLUMN IF EXISTS claimed_at,
+DROP COLUMN IF EXISTS attempts,
+ALTER COLUMN token SET NOT NULL;
@@ -0,0 +1,9 @@
+-- exports are built by a worker claiming the pending ones; the download token
+-- is issued once the archive is ready
+ALTER TABLE data_exports
+ALTER COLUMN token DROP NOT NULL,
+ADD COLUMN IF NOT EXISTS attempts int NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS claimed_at timestamp(0) with time zone;
+
+-- the worker picks the pending exports
+CREATE INDEX IF NOT EXISTS idx_data_exports_claimed_at ON data_exports (claimed_at) WHERE status = 'pending';
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is an asymmetric key identified by its kid. Retired keys keep
+// only the public half so tokens they signed can still be verified.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySetConfig signs tokens with RS256 or EdDSA using the active key and
+// verifies them with whichever key the kid header points to.
+type KeySetConfig struct {
+	mu        sync.RWMutex
+	keys      map[string]*SigningKey
+	activeKID string
+	aud       string
+	iss       string
+}
+
+func NewKeySetConfig(aud, iss string) *KeySetConfig {
+	return &KeySetConfig{
+		keys: make(map[string]*SigningKey),
+		aud:  aud,
+		iss:  iss,
+	}
+}
+
+// LoadDir replaces the key set with the PEM files of dir, using the file name
+// without extension as kid. Private keys are PKCS#8, public keys PKIX. When
+// activeKID is empty the kid is read from the "active" file of dir, so keys
+// can be rotated by editing that file and reloading.
+func (k *KeySetConfig) LoadDir(dir, activeKID string) error {
+	if activeKID == "" {
+		data, err := os.ReadFile(filepath.Join(dir, "active"))
+		if err != nil {
+			return fmt.Errorf("reading active key id: %w", err)
+		}
+
+		activeKID = strings.TrimSpace(string(data))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*SigningKey, len(files))
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+
+		key, err := loadKeyFile(kid, file)
+		if err != nil {
+			return fmt.Errorf("loading key %s: %w", kid, err)
+		}
+
+		keys[kid] = key
+	}
+
+	active, ok := keys[activeKID]
+	if !ok {
+		return fmt.Errorf("active key %q not found in %s", activeKID, dir)
+	}
+
+	if active.Private == nil {
+		return fmt.Errorf("active key %q has no private key", activeKID)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.activeKID = activeKID
+	k.mu.Unlock()
+
+	return nil
+}
+
+// AddKey adds a key to the set, replacing a key with the same kid.
+func (k *KeySetConfig) AddKey(key *SigningKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[key.ID] = key
+}
+
+// SetActive switches the key new tokens are signed with. Tokens signed by
+// the previous key stay valid as long as that key remains in the set.
+func (k *KeySetConfig) SetActive(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown key %q", kid)
+	}
+
+	if key.Private == nil {
+		return fmt.Errorf("key %q has no private key", kid)
+	}
+
+	k.activeKID = kid
+	return nil
+}
+
+func (k *KeySetConfig) GenerateToken(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key, ok := k.keys[k.activeKID]
+	k.mu.RUnlock()
+
+	if !ok {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+func (k *KeySetConfig) ValidateToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("missing kid header")
+		}
+
+		k.mu.RLock()
+		key, ok := k.keys[kid]
+		k.mu.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+
+		return key.Public, nil
+	},
+		jwt.WithExpirationRequired(), // Ensure the token is not expired
+		jwt.WithAudience(k.aud),      // Ensure the token has the correct audience
+		jwt.WithIssuer(k.iss),        // Ensure the token has the correct issuer
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name, jwt.SigningMethodEdDSA.Alg()}), // Ensure the token has the correct signing method
+	)
+}
+
+// KeyPublisher is implemented by authenticators whose verification keys can
+// be shared with other services.
+type KeyPublisher interface {
+	JWKS() JWKSet
+}
+
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public half of every key in the set.
+func (k *KeySetConfig) JWKS() JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk := JWK{
+			Kid: key.ID,
+			Alg: key.Method.Alg(),
+			Use: "sig",
+		}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func loadKeyFile(kid, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+
+		return NewSigningKey(kid, signer, signer.Public())
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewSigningKey(kid, nil, parsed)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// NewSigningKey picks the signing method matching the key type. private may
+// be nil for verification only keys.
+func NewSigningKey(kid string, private crypto.Signer, public crypto.PublicKey) (*SigningKey, error) {
+	key := &SigningKey{
+		ID:      kid,
+		Private: private,
+		Public:  public,
+	}
+
+	switch public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("unsupported key type, use RSA or Ed25519")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKeySet(t *testing.T) *KeySetConfig {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := NewKeySetConfig("test-aud", "test-iss")
+
+	key, err := NewSigningKey("rsa-1", rsaKey, rsaKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.AddKey(key)
+
+	key, err = NewSigningKey("ed-1", edKey, edKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.AddKey(key)
+
+	if err := ks.SetActive("rsa-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	return ks
+}
+
+func TestKeySetRotation(t *testing.T) {
+	ks := newTestKeySet(t)
+
+	claims := jwt.MapClaims{
+		"sub": 1,
+		"aud": "test-aud",
+		"iss": "test-iss",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	oldToken, err := ks.GenerateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.SetActive("ed-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	newToken, err := ks.GenerateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should sign with the active key", func(t *testing.T) {
+		token, err := ks.ValidateToken(newToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.Header["kid"] != "ed-1" || token.Method.Alg() != jwt.SigningMethodEdDSA.Alg() {
+			t.Errorf("expected an EdDSA token signed by ed-1; got %v signed by %v", token.Method.Alg(), token.Header["kid"])
+		}
+	})
+
+	t.Run("should accept tokens signed by the previous key", func(t *testing.T) {
+		if _, err := ks.ValidateToken(oldToken); err != nil {
+			t.Errorf("expected the old token to be valid: %v", err)
+		}
+	})
+
+	t.Run("should reject tokens of unknown keys", func(t *testing.T) {
+		other := newTestKeySet(t)
+
+		token, err := other.GenerateToken(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ks.ValidateToken(token); err == nil {
+			t.Error("expected a token signed by another key to be rejected")
+		}
+	})
+
+	t.Run("should publish every public key", func(t *testing.T) {
+		jwks := ks.JWKS()
+
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("expected 2 keys; got %d", len(jwks.Keys))
+		}
+
+		for _, key := range jwks.Keys {
+			if key.Kid == "rsa-1" && (key.Kty != "RSA" || key.N == "" || key.E == "") {
+				t.Errorf("malformed RSA key: %+v", key)
+			}
+
+			if key.Kid == "ed-1" && (key.Kty != "OKP" || key.Crv != "Ed25519" || key.X == "") {
+				t.Errorf("malformed Ed25519 key: %+v", key)
+			}
+		}
+	})
+}
+
+func TestKeySetLoadDir(t *testing.T) {
+	dir := t.TempDir()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"current.pem":  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		"previous.pem": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+		"active":       []byte("current\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ks := NewKeySetConfig("test-aud", "test-iss")
+
+	t.Run("should read the active kid from the directory", func(t *testing.T) {
+		if err := ks.LoadDir(dir, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ks.JWKS().Keys) != 2 {
+			t.Errorf("expected 2 keys; got %d", len(ks.JWKS().Keys))
+		}
+	})
+
+	t.Run("should not sign with a public key", func(t *testing.T) {
+		if err := ks.LoadDir(dir, "previous"); err == nil {
+			t.Error("expected a verification only key to be rejected as active key")
+		}
+	})
+}
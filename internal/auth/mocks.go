@@ -14,6 +14,7 @@ var testClaims = jwt.MapClaims{
 	"aud": "test-aud",
 	"iss": "test-aud",
 	"sub": int64(1),
+	"jti": "test-jti",
 	"exp": time.Now().Add(time.Hour).Unix(),
 }
 
@@ -29,3 +30,20 @@ func (a *TestAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 		return []byte(secret), nil
 	})
 }
+
+// TestClaimsAuthenticator signs the claims it is given, and the test claims
+// when given none, for tests relying on the claims of the tokens they get.
+type TestClaimsAuthenticator struct {
+	TestAuthenticator
+}
+
+func (a *TestClaimsAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	if claims == nil {
+		claims = testClaims
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenString, _ := token.SignedString([]byte(secret))
+	return tokenString, nil
+}
@@ -0,0 +1,32 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrNotFound         = errors.New("blob not found")
+	ErrInvalidKey       = errors.New("invalid blob key")
+	ErrInvalidSignature = errors.New("invalid or expired signature")
+)
+
+// Storage keeps uploaded files. Keys are slash separated paths such as
+// "avatars/1/2f1c.png".
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL anyone can download the blob from until the
+	// expiry elapses.
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// URLVerifier is implemented by backends whose signed URLs point back at the
+// API, which then has to check the signature before serving the blob.
+type URLVerifier interface {
+	Verify(key string, query url.Values) error
+}
@@ -0,0 +1,122 @@
+package diff
+
+import "unicode"
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Chunk is a run of text kept, inserted or deleted between two texts.
+type Chunk struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Words compares a and b word by word. Whitespace is kept, so joining the
+// equal and deleted chunks gives a back, and the equal and inserted ones b.
+func Words(a, b string) []Chunk {
+	x, y := tokenize(a), tokenize(b)
+
+	// the common prefix and suffix are left out of the quadratic part
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var chunks []Chunk
+	for _, t := range x[:prefix] {
+		chunks = appendChunk(chunks, Equal, t)
+	}
+
+	chunks = lcs(chunks, x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])
+
+	for _, t := range x[len(x)-suffix:] {
+		chunks = appendChunk(chunks, Equal, t)
+	}
+
+	return chunks
+}
+
+// lcs appends the chunks turning x into y, keeping their longest common
+// subsequence of tokens.
+func lcs(chunks []Chunk, x, y []string) []Chunk {
+	// lengths[i][j] is the length of the subsequence of x[i:] and y[j:]
+	lengths := make([][]int32, len(x)+1)
+	for i := range lengths {
+		lengths[i] = make([]int32, len(y)+1)
+	}
+
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			chunks = appendChunk(chunks, Equal, x[i])
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			chunks = appendChunk(chunks, Delete, x[i])
+			i++
+		default:
+			chunks = appendChunk(chunks, Insert, y[j])
+			j++
+		}
+	}
+
+	for ; i < len(x); i++ {
+		chunks = appendChunk(chunks, Delete, x[i])
+	}
+	for ; j < len(y); j++ {
+		chunks = appendChunk(chunks, Insert, y[j])
+	}
+
+	return chunks
+}
+
+// appendChunk merges consecutive tokens of the same operation.
+func appendChunk(chunks []Chunk, op Op, text string) []Chunk {
+	if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+		chunks[n-1].Text += text
+		return chunks
+	}
+
+	return append(chunks, Chunk{Op: op, Text: text})
+}
+
+// tokenize splits s into alternating runs of whitespace and other characters.
+func tokenize(s string) []string {
+	var tokens []string
+
+	start, space := 0, false
+	for i, r := range s {
+		if i > start && unicode.IsSpace(r) != space {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+
+	return tokens
+}
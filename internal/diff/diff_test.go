@@ -0,0 +1,52 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Chunk
+	}{
+		{"same text", "hello world", "hello world", []Chunk{{Equal, "hello world"}}},
+		{"replaced word", "hello there world", "hello big world", []Chunk{
+			{Equal, "hello "},
+			{Delete, "there"},
+			{Insert, "big"},
+			{Equal, " world"},
+		}},
+		{"appended words", "hello", "hello world", []Chunk{{Equal, "hello"}, {Insert, " world"}}},
+		{"removed words", "a b c", "a c", []Chunk{{Equal, "a "}, {Delete, "b "}, {Equal, "c"}}},
+		{"from empty", "", "hello", []Chunk{{Insert, "hello"}}},
+		{"to empty", "hello", "", []Chunk{{Delete, "hello"}}},
+		{"both empty", "", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Words(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+
+			// both texts are rebuilt from the chunks
+			var a, b strings.Builder
+			for _, c := range got {
+				if c.Op != Insert {
+					a.WriteString(c.Text)
+				}
+				if c.Op != Delete {
+					b.WriteString(c.Text)
+				}
+			}
+
+			if a.String() != tt.a || b.String() != tt.b {
+				t.Errorf("expected %q and %q, got %q and %q", tt.a, tt.b, a.String(), b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Package imaging normalizes user uploaded images: it applies the EXIF
+// orientation, strips every piece of metadata by re-encoding the pixels,
+// resizes them to a fixed set of sizes and computes a blurhash placeholder.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	_ "image/gif"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// maxPixels guards against decompression bombs, small files declaring
+	// huge dimensions
+	maxPixels = 50_000_000
+
+	jpegQuality = 85
+
+	// blurhash components and the size of the image it is computed on
+	blurhashX    = 4
+	blurhashY    = 3
+	blurhashSize = 32
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+// Size is a variant generated for every image, fitting in a square of
+// MaxDimension pixels. Images are never upscaled.
+type Size struct {
+	Name         string
+	MaxDimension int
+}
+
+// DefaultSizes are the variants generated for post images.
+var DefaultSizes = []Size{
+	{Name: "original", MaxDimension: 2048},
+	{Name: "large", MaxDimension: 1280},
+	{Name: "medium", MaxDimension: 640},
+	{Name: "thumbnail", MaxDimension: 160},
+}
+
+// Variant is an encoded image of one of the sizes.
+type Variant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Ext         string
+	Data        []byte
+}
+
+// Result holds the dimensions of the upright image, its blurhash and the
+// generated variants, in the order of the sizes.
+type Result struct {
+	Width    int
+	Height   int
+	Blurhash string
+	Variants []Variant
+}
+
+// Process decodes a JPEG, PNG, GIF or WebP image and generates its variants.
+// Opaque images are encoded as JPEG, the others as PNG to keep transparency.
+// Only the first frame of animated images is kept.
+func Process(data []byte, sizes []Size) (*Result, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	img := toNRGBA(decoded)
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	bounds := img.Bounds()
+	result := &Result{
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Blurhash: Blurhash(resize(img, blurhashSize), blurhashX, blurhashY),
+	}
+
+	opaque := img.Opaque()
+
+	for _, size := range sizes {
+		resized := resize(img, size.MaxDimension)
+
+		variant := Variant{
+			Name:   size.Name,
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+		}
+
+		var buf bytes.Buffer
+		if opaque {
+			variant.ContentType, variant.Ext = "image/jpeg", ".jpg"
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			variant.ContentType, variant.Ext = "image/png", ".png"
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		variant.Data = buf.Bytes()
+		result.Variants = append(result.Variants, variant)
+	}
+
+	return result, nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Bounds().Min == (image.Point{}) {
+		return nrgba
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	return dst
+}
+
+// resize scales img down to fit in a square of maxDimension pixels, keeping
+// its aspect ratio.
+func resize(img *image.NRGBA, maxDimension int) *image.NRGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	if w <= maxDimension && h <= maxDimension {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxDimension/w)
+		w = maxDimension
+	} else {
+		w = max(1, w*maxDimension/h)
+		h = maxDimension
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+
+	return dst
+}
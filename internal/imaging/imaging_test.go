@@ -0,0 +1,131 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func solidImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF segment with the orientation tag right
+// after the start of image marker of a JPEG file.
+func withOrientation(t *testing.T, data []byte, orientation uint16) []byte {
+	t.Helper()
+
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("MM")
+	binary.Write(tiff, binary.BigEndian, uint16(42))
+	binary.Write(tiff, binary.BigEndian, uint32(8))
+	// one IFD entry: tag, type SHORT, count 1, value padded to 4 bytes
+	binary.Write(tiff, binary.BigEndian, uint16(1))
+	binary.Write(tiff, binary.BigEndian, []uint16{exifOrientationTag, 3})
+	binary.Write(tiff, binary.BigEndian, uint32(1))
+	binary.Write(tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	out := new(bytes.Buffer)
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(data[2:])
+
+	return out.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	t.Run("should apply the orientation and strip the metadata", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, solidImage(400, 200, color.NRGBA{200, 30, 30, 255}), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// rotated 90 clockwise
+		data := withOrientation(t, buf.Bytes(), 6)
+		if got := jpegOrientation(data); got != 6 {
+			t.Fatalf("expected orientation 6, got %d", got)
+		}
+
+		result, err := Process(data, DefaultSizes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Width != 200 || result.Height != 400 {
+			t.Errorf("expected an upright 200x400 image, got %dx%d", result.Width, result.Height)
+		}
+
+		if len(result.Variants) != len(DefaultSizes) {
+			t.Fatalf("expected %d variants, got %d", len(DefaultSizes), len(result.Variants))
+		}
+
+		thumbnail := result.Variants[3]
+		if thumbnail.Width != 80 || thumbnail.Height != 160 {
+			t.Errorf("expected an 80x160 thumbnail, got %dx%d", thumbnail.Width, thumbnail.Height)
+		}
+
+		for _, v := range result.Variants {
+			if v.ContentType != "image/jpeg" {
+				t.Errorf("expected %s to be a JPEG, got %s", v.Name, v.ContentType)
+			}
+			if bytes.Contains(v.Data, []byte("Exif")) {
+				t.Errorf("expected the EXIF data to be stripped from %s", v.Name)
+			}
+		}
+
+		// images are not upscaled
+		if original := result.Variants[0]; original.Width != 200 || original.Height != 400 {
+			t.Errorf("expected the original size to be kept, got %dx%d", original.Width, original.Height)
+		}
+
+		if len(result.Blurhash) != 28 {
+			t.Errorf("expected a 4x3 blurhash, got %q", result.Blurhash)
+		}
+	})
+
+	t.Run("should keep transparency", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, solidImage(10, 10, color.NRGBA{0, 0, 0, 100})); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := Process(buf.Bytes(), DefaultSizes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ct := result.Variants[0].ContentType; ct != "image/png" {
+			t.Errorf("expected a PNG, got %s", ct)
+		}
+	})
+
+	t.Run("should reject other formats", func(t *testing.T) {
+		if _, err := Process([]byte("%PDF-1.4"), DefaultSizes); err != ErrUnsupportedFormat {
+			t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+		}
+	})
+}
+
+func TestBlurhash(t *testing.T) {
+	// the well known hash of a black image
+	want := "L00000fQfQfQfQfQfQfQfQfQfQfQ"
+
+	if got := Blurhash(solidImage(8, 8, color.NRGBA{0, 0, 0, 255}), 4, 3); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
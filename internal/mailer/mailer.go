@@ -3,9 +3,16 @@ package mailer
 import "embed"
 
 const (
-	FromEmail           = "GoSocial"
-	MaxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromEmail                     = "GoSocial"
+	MaxRetries                    = 3
+	UserWelcomeTemplate           = "user_invitation.tmpl"
+	PasswordResetTemplate         = "password_reset.tmpl"
+	AccountLockedTemplate         = "account_locked.tmpl"
+	EmailChangeTemplate           = "email_change.tmpl"
+	DataExportTemplate            = "data_export.tmpl"
+	AccountDeletionTemplate       = "account_deletion.tmpl"
+	FollowRequestApprovedTemplate = "follow_request_approved.tmpl"
+	IdentityLinkTemplate          = "identity_link.tmpl"
 )
 
 //go:embed "templates"
@@ -0,0 +1,33 @@
+package mailer
+
+import "sync"
+
+// SentEmail is an email recorded by MockMailer.
+type SentEmail struct {
+	Template string
+	Email    string
+	Data     any
+}
+
+// MockMailer records the emails instead of sending them. Emails are often
+// sent in the background, hence the lock.
+type MockMailer struct {
+	mu   sync.Mutex
+	sent []SentEmail
+}
+
+func (m *MockMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, SentEmail{Template: templateFile, Email: email, Data: data})
+	return 200, nil
+}
+
+// Sent returns the emails sent so far.
+func (m *MockMailer) Sent() []SentEmail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]SentEmail(nil), m.sent...)
+}
@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github/hassanharga/go-social/internal/oidc/oidctest"
+)
+
+func TestProvider(t *testing.T) {
+	server, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	provider := NewProvider(Config{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+		RedirectURL:  "http://localhost/callback",
+	}, nil)
+
+	ctx := context.Background()
+
+	// authorize returns the code the provider redirects back with
+	authorize := func(t *testing.T, state, nonce, verifier string) string {
+		t.Helper()
+
+		authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		resp, err := client.Get(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		location, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if location.Query().Get("state") != state {
+			t.Fatalf("expected state %q; got %q", state, location.Query().Get("state"))
+		}
+
+		return location.Query().Get("code")
+	}
+
+	t.Run("should exchange the code for verified claims", func(t *testing.T) {
+		code := authorize(t, "state", "nonce", "verifier")
+
+		claims, err := provider.Exchange(ctx, code, "verifier", "nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Subject != server.User.Subject || claims.Email != server.User.Email || !claims.EmailVerified {
+			t.Errorf("unexpected claims: %+v", claims)
+		}
+	})
+
+	t.Run("should reject a wrong PKCE verifier", func(t *testing.T) {
+		code := authorize(t, "state", "nonce", "verifier")
+
+		if _, err := provider.Exchange(ctx, code, "another-verifier", "nonce"); err == nil {
+			t.Error("expected the exchange to fail")
+		}
+	})
+
+	t.Run("should reject a wrong nonce", func(t *testing.T) {
+		code := authorize(t, "state", "nonce", "verifier")
+
+		if _, err := provider.Exchange(ctx, code, "verifier", "another-nonce"); err != ErrNonceMismatch {
+			t.Errorf("expected %v; got %v", ErrNonceMismatch, err)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	// DeletionModeDelete removes the posts and comments of the user.
+	DeletionModeDelete = "delete"
+	// DeletionModeAnonymize keeps the posts and comments of the user under
+	// the tombstone "deleted user".
+	DeletionModeAnonymize = "anonymize"
+)
+
+// AccountDeletion is a requested account deletion, carried out once
+// ScheduledAt has passed unless cancelled.
+type AccountDeletion struct {
+	UserID      int64     `json:"user_id"`
+	Mode        string    `json:"mode"`
+	RequestedAt time.Time `json:"requested_at"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+// deleting an account touches every row of the user
+const accountDeletionTimeout = time.Minute
+
+type AccountDeletionStore struct {
+	db *sql.DB
+}
+
+// Schedule requests the deletion of an account after gracePeriod, replacing
+// a previous request.
+func (s *AccountDeletionStore) Schedule(ctx context.Context, deletion *AccountDeletion, gracePeriod time.Duration) error {
+	query := `
+		INSERT INTO account_deletions (user_id, mode, scheduled_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET mode = EXCLUDED.mode, requested_at = NOW(), scheduled_at = EXCLUDED.scheduled_at
+		RETURNING requested_at, scheduled_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		deletion.UserID,
+		deletion.Mode,
+		time.Now().Add(gracePeriod),
+	).Scan(&deletion.RequestedAt, &deletion.ScheduledAt)
+}
+
+func (s *AccountDeletionStore) Get(ctx context.Context, userID int64) (*AccountDeletion, error) {
+	query := `
+		SELECT user_id, mode, requested_at, scheduled_at
+		FROM account_deletions
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	deletion := &AccountDeletion{}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&deletion.UserID,
+		&deletion.Mode,
+		&deletion.RequestedAt,
+		&deletion.ScheduledAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return deletion, nil
+}
+
+func (s *AccountDeletionStore) Cancel(ctx context.Context, userID int64) error {
+	query := `DELETE FROM account_deletions WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Due returns up to limit deletions whose grace period is over. Deletions
+// being carried out by a concurrent sweep are skipped; UserStore.DeleteAccount
+// claims each one again, so an account is deleted exactly once.
+func (s *AccountDeletionStore) Due(ctx context.Context, limit int) ([]AccountDeletion, error) {
+	query := `
+		SELECT user_id, mode, requested_at, scheduled_at
+		FROM account_deletions
+		WHERE scheduled_at <= $1
+		ORDER BY scheduled_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []AccountDeletion
+	for rows.Next() {
+		var d AccountDeletion
+		if err := rows.Scan(&d.UserID, &d.Mode, &d.RequestedAt, &d.ScheduledAt); err != nil {
+			return nil, err
+		}
+
+		deletions = append(deletions, d)
+	}
+
+	return deletions, rows.Err()
+}
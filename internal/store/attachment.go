@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+const (
+	AttachmentTypeImage = "image"
+	AttachmentTypeVideo = "video"
+	AttachmentTypeFile  = "file"
+)
+
+// Attachment is a file uploaded together with a post and stored in the blob
+// storage under Key.
+type Attachment struct {
+	ID          int64  `json:"id"`
+	PostID      int64  `json:"post_id"`
+	Type        string `json:"type"`
+	Key         string `json:"-"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	AltText     string `json:"alt_text"`
+	Position    int    `json:"position"`
+	CreatedAt   string `json:"created_at"`
+	// signed download URL, set when the attachment is returned to a client
+	URL string `json:"url,omitempty"`
+}
+
+type AttachmentStore struct {
+	db *sql.DB
+}
+
+func createAttachments(ctx context.Context, tx *sql.Tx, post *Post) error {
+	query := `
+		INSERT INTO attachments (post_id, type, key, content_type, size, width, height, alt_text, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+	`
+
+	for i := range post.Attachments {
+		a := &post.Attachments[i]
+		a.PostID = post.ID
+		a.Position = i
+
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			a.PostID,
+			a.Type,
+			a.Key,
+			a.ContentType,
+			a.Size,
+			a.Width,
+			a.Height,
+			a.AltText,
+			a.Position,
+		).Scan(&a.ID, &a.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetByPostIDs returns the attachments of several posts at once, by post ID.
+func (s *AttachmentStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Attachment, error) {
+	query := `
+		SELECT id, post_id, type, key, content_type, size, width, height, alt_text, position, created_at
+		FROM attachments
+		WHERE post_id = ANY($1)
+		ORDER BY post_id, position
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make(map[int64][]Attachment)
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(
+			&a.ID,
+			&a.PostID,
+			&a.Type,
+			&a.Key,
+			&a.ContentType,
+			&a.Size,
+			&a.Width,
+			&a.Height,
+			&a.AltText,
+			&a.Position,
+			&a.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		attachments[a.PostID] = append(attachments[a.PostID], a)
+	}
+
+	return attachments, rows.Err()
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RestrictedUser is a user blocked or muted by the current user.
+type RestrictedUser struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	Since       time.Time `json:"since"`
+}
+
+// RestrictedUserPage is a page of blocked or muted users. NextCursor is empty
+// on the last page.
+type RestrictedUserPage struct {
+	Users      []RestrictedUser `json:"users"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block makes blockerID block blockedID. Follows and follow requests between
+// them are removed in both directions.
+func (s *BlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := restrict(ctx, tx, "user_blocks", "blocker_id", "blocked_id", blockerID, blockedID); err != nil {
+			return err
+		}
+
+		query := `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+			RETURNING user_id, follower_id
+		`
+
+		rows, err := tx.QueryContext(ctx, query, blockerID, blockedID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var follows [][2]int64
+		for rows.Next() {
+			var userID, followerID int64
+			if err := rows.Scan(&userID, &followerID); err != nil {
+				return err
+			}
+			follows = append(follows, [2]int64{followerID, userID})
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, f := range follows {
+			if err := updateFollowCounts(ctx, tx, f[0], f[1], -1); err != nil {
+				return err
+			}
+		}
+
+		query = `
+			DELETE FROM follow_requests
+			WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+		`
+
+		_, err = tx.ExecContext(ctx, query, blockerID, blockedID)
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	return unrestrict(ctx, s.db, "user_blocks", "blocker_id", "blocked_id", blockerID, blockedID)
+}
+
+// GetBlocked lists the users blocked by userID, most recently blocked first.
+func (s *BlockStore) GetBlocked(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*RestrictedUserPage, error) {
+	return listRestricted(ctx, s.db, "user_blocks", "blocker_id", "blocked_id", userID, fq)
+}
+
+// IsBlocked reports whether either user blocked the other.
+func (s *BlockStore) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	if err := s.db.QueryRowContext(ctx, query, userID, otherID).Scan(&blocked); err != nil {
+		return false, err
+	}
+
+	return blocked, nil
+}
+
+type MuteStore struct {
+	db *sql.DB
+}
+
+// Mute hides the posts of mutedID from the feed of muterID. Nothing else
+// changes and mutedID is not told.
+func (s *MuteStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	if muterID == mutedID {
+		return ErrSelfMute
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return restrict(ctx, tx, "user_mutes", "muter_id", "muted_id", muterID, mutedID)
+	})
+}
+
+func (s *MuteStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	return unrestrict(ctx, s.db, "user_mutes", "muter_id", "muted_id", muterID, mutedID)
+}
+
+// GetMuted lists the users muted by userID, most recently muted first.
+func (s *MuteStore) GetMuted(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*RestrictedUserPage, error) {
+	return listRestricted(ctx, s.db, "user_mutes", "muter_id", "muted_id", userID, fq)
+}
+
+// restrict adds a block or a mute of an active user.
+func restrict(ctx context.Context, tx *sql.Tx, table, owner, other string, ownerID, otherID int64) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %[1]s (%[2]s, %[3]s)
+		SELECT $1, id FROM users
+		WHERE id = $2 AND is_active = true AND is_tombstone = false
+	`, table, owner, other)
+
+	res, err := tx.ExecContext(ctx, query, ownerID, otherID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func unrestrict(ctx context.Context, db *sql.DB, table, owner, other string, ownerID, otherID int64) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND %s = $2`, table, owner, other)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx, query, ownerID, otherID)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func listRestricted(ctx context.Context, db *sql.DB, table, owner, other string, userID int64, fq PaginatedFollowQuery) (*RestrictedUserPage, error) {
+	query := fmt.Sprintf(`
+		SELECT u.id, u.username, u.display_name, u.avatar_url, r.created_at
+		FROM %[1]s r
+		JOIN users u ON u.id = r.%[3]s
+		WHERE r.%[2]s = $1
+			AND ($2::timestamptz IS NULL OR (r.created_at, r.%[3]s) < ($2, $3))
+		ORDER BY r.created_at DESC, r.%[3]s DESC
+		LIMIT $4
+	`, table, owner, other)
+
+	var cursorTime *time.Time
+	var cursorID int64
+	if fq.Cursor != nil {
+		cursorTime, cursorID = &fq.Cursor.CreatedAt, fq.Cursor.UserID
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// one more row tells whether there is a next page
+	rows, err := db.QueryContext(ctx, query, userID, cursorTime, cursorID, fq.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &RestrictedUserPage{Users: []RestrictedUser{}}
+	for rows.Next() {
+		var u RestrictedUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL, &u.Since); err != nil {
+			return nil, err
+		}
+
+		page.Users = append(page.Users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Users) > fq.Limit {
+		page.Users = page.Users[:fq.Limit]
+
+		last := page.Users[fq.Limit-1]
+		page.NextCursor = FollowCursor{CreatedAt: last.Since, UserID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
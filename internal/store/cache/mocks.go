@@ -3,13 +3,16 @@ package cache
 import (
 	"context"
 	"github/hassanharga/go-social/internal/store"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:       &MockUserStore{},
+		Suggestions: &MockSuggestionStore{},
+		Tokens:      &MockTokenStore{},
 	}
 }
 
@@ -30,3 +33,36 @@ func (m *MockUserStore) Set(ctx context.Context, user *store.User) error {
 func (m *MockUserStore) Delete(ctx context.Context, userID int64) {
 	m.Called(userID)
 }
+
+type MockSuggestionStore struct {
+	mock.Mock
+}
+
+func (m *MockSuggestionStore) Get(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	args := m.Called(userID)
+	suggestions, _ := args.Get(0).([]store.Suggestion)
+	return suggestions, args.Error(1)
+}
+
+func (m *MockSuggestionStore) Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error {
+	args := m.Called(userID, suggestions)
+	return args.Error(0)
+}
+
+func (m *MockSuggestionStore) Delete(ctx context.Context, userID int64) {
+	m.Called(userID)
+}
+
+type MockTokenStore struct{}
+
+func (m *MockTokenStore) Revoke(ctx context.Context, jti string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockTokenStore) RevokeAll(ctx context.Context, userID int64, before time.Time, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockTokenStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	return false, nil
+}
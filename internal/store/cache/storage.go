@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"github/hassanharga/go-social/internal/store"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -13,10 +14,22 @@ type Storage struct {
 		Set(context.Context, *store.User) error
 		Delete(context.Context, int64)
 	}
+	Suggestions interface {
+		Get(ctx context.Context, userID int64) ([]store.Suggestion, error)
+		Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error
+		Delete(ctx context.Context, userID int64)
+	}
+	Tokens interface {
+		Revoke(ctx context.Context, jti string, exp time.Duration) error
+		RevokeAll(ctx context.Context, userID int64, before time.Time, exp time.Duration) error
+		IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error)
+	}
 }
 
 func NewRedisStorage(rbd *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{rdb: rbd},
+		Users:       &UserStore{rdb: rbd},
+		Suggestions: &SuggestionStore{rdb: rbd},
+		Tokens:      &TokenStore{rdb: rbd},
 	}
 }
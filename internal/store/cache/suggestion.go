@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github/hassanharga/go-social/internal/store"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type SuggestionStore struct {
+	rdb *redis.Client
+}
+
+// suggestions are expensive to rank and change slowly
+const SuggestionsExpTime = 15 * time.Minute
+
+// Get returns nil when the suggestions of the user are not cached.
+func (s *SuggestionStore) Get(ctx context.Context, userID int64) ([]store.Suggestion, error) {
+	cacheKey := fmt.Sprintf("suggestions-%d", userID)
+
+	data, err := s.rdb.Get(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	suggestions := []store.Suggestion{}
+	if err := json.Unmarshal([]byte(data), &suggestions); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+func (s *SuggestionStore) Set(ctx context.Context, userID int64, suggestions []store.Suggestion) error {
+	cacheKey := fmt.Sprintf("suggestions-%d", userID)
+
+	json, err := json.Marshal(suggestions)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEX(ctx, cacheKey, json, SuggestionsExpTime).Err()
+}
+
+func (s *SuggestionStore) Delete(ctx context.Context, userID int64) {
+	cacheKey := fmt.Sprintf("suggestions-%d", userID)
+	s.rdb.Del(ctx, cacheKey)
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type TokenStore struct {
+	rdb *redis.Client
+}
+
+func (s *TokenStore) Revoke(ctx context.Context, jti string, exp time.Duration) error {
+	cacheKey := fmt.Sprintf("revoked-token-%s", jti)
+
+	return s.rdb.SetEX(ctx, cacheKey, 1, exp).Err()
+}
+
+// RevokeAll revokes every token of the user issued before the given time. The
+// entry only has to outlive the longest lived token, hence exp.
+func (s *TokenStore) RevokeAll(ctx context.Context, userID int64, before time.Time, exp time.Duration) error {
+	cacheKey := fmt.Sprintf("revoked-user-%d", userID)
+
+	return s.rdb.SetEX(ctx, cacheKey, before.Unix(), exp).Err()
+}
+
+func (s *TokenStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	exists, err := s.rdb.Exists(ctx, fmt.Sprintf("revoked-token-%s", jti)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if exists > 0 {
+		return true, nil
+	}
+
+	data, err := s.rdb.Get(ctx, fmt.Sprintf("revoked-user-%d", userID)).Result()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	before, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	return issuedAt.Unix() < before, nil
+}
@@ -45,18 +45,23 @@ func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 	return nil
 }
 
-func (s *CommentStore) GetByPostId(ctx context.Context, postId int64) ([]Comment, error) {
+// GetByPostId lists the comments of a post, without those of users blocked
+// by or blocking viewerID.
+func (s *CommentStore) GetByPostId(ctx context.Context, postId, viewerID int64) ([]Comment, error) {
 	query := `
 		SELECT c.id, c.content, c.user_id, c.post_id, c.created_at, users.username, users.id
 		FROM comments c
 		JOIN users ON c.user_id = users.id
-		WHERE c.post_id = $1
+		WHERE c.post_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = $2 AND b.blocked_id = c.user_id) OR (b.blocker_id = c.user_id AND b.blocked_id = $2)
+		)
 		ORDER BY c.created_at DESC
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postId)
+	rows, err := s.db.QueryContext(ctx, query, postId, viewerID)
 	if err != nil {
 		return nil, err
 	}
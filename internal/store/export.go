@@ -0,0 +1,486 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is an archive of everything stored about a user, prepared in
+// the background and downloaded with a token sent by email.
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	Key         string     `json:"-"`
+	Size        int64      `json:"size"`
+	Error       string     `json:"error,omitempty"`
+	Attempts    int        `json:"-"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Relation is a follower or a followed user in a data export.
+type Relation struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+}
+
+// UserData is the content of a data export, besides the profile.
+type UserData struct {
+	Posts     []Post     `json:"posts"`
+	Comments  []Comment  `json:"comments"`
+	Followers []Relation `json:"followers"`
+	Following []Relation `json:"following"`
+	Uploads   []Upload   `json:"uploads"`
+}
+
+// exports read every row of a user, which takes longer than a single query
+const exportQueryTimeout = time.Minute
+
+type DataExportStore struct {
+	db *sql.DB
+}
+
+// Create adds a pending export, built by the export worker. ErrConflict is
+// returned while another export of the user is pending.
+func (s *DataExportStore) Create(ctx context.Context, export *DataExport, exp time.Duration) error {
+	query := `
+		INSERT INTO data_exports (user_id, expires_at)
+		VALUES ($1, $2)
+		RETURNING id, status, expires_at, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, export.UserID, time.Now().Add(exp)).Scan(
+		&export.ID,
+		&export.Status,
+		&export.ExpiresAt,
+		&export.CreatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// ClaimPending claims up to limit pending exports and returns them. Exports
+// claimed longer than staleAfter ago, by a worker that died, are claimed
+// again. Concurrent workers never claim the same export.
+func (s *DataExportStore) ClaimPending(ctx context.Context, limit int, staleAfter time.Duration) ([]DataExport, error) {
+	query := `
+		UPDATE data_exports
+		SET attempts = attempts + 1, claimed_at = NOW()
+		WHERE id IN (
+			SELECT id FROM data_exports
+			WHERE status = 'pending'
+				AND (claimed_at IS NULL OR claimed_at < NOW() - $2 * interval '1 second')
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, status, attempts, expires_at, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, int64(staleAfter.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []DataExport
+	for rows.Next() {
+		var export DataExport
+		if err := rows.Scan(
+			&export.ID,
+			&export.UserID,
+			&export.Status,
+			&export.Attempts,
+			&export.ExpiresAt,
+			&export.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		exports = append(exports, export)
+	}
+
+	return exports, rows.Err()
+}
+
+// Complete stores the archive of an export and the download token sent by
+// email. It returns ErrNotFound when the claim was lost: the export went
+// stale and was claimed again.
+func (s *DataExportStore) Complete(ctx context.Context, export *DataExport, token string) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'ready', token = $2, key = $3, size = $4, completed_at = NOW()
+		WHERE id = $1 AND status = 'pending' AND attempts = $5
+		RETURNING status, completed_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		export.ID,
+		hashToken(token),
+		export.Key,
+		export.Size,
+		export.Attempts,
+	).Scan(&export.Status, &export.CompletedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// Fail gives up on an export, returning ErrNotFound like Complete when the
+// claim was lost.
+func (s *DataExportStore) Fail(ctx context.Context, export *DataExport, reason string) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE id = $1 AND status = 'pending' AND attempts = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, export.ID, reason, export.Attempts)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrNotFound
+	}
+
+	export.Status = DataExportFailed
+
+	return nil
+}
+
+// GetByToken returns the ready and unexpired export of a download token.
+func (s *DataExportStore) GetByToken(ctx context.Context, token string) (*DataExport, error) {
+	query := `
+		SELECT id, user_id, status, key, size, expires_at, created_at, completed_at
+		FROM data_exports
+		WHERE token = $1 AND status = 'ready' AND expires_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	export := &DataExport{}
+	err := s.db.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.Key,
+		&export.Size,
+		&export.ExpiresAt,
+		&export.CreatedAt,
+		&export.CompletedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return export, nil
+}
+
+// DeleteExpired removes the expired exports and returns the keys of their
+// archives for the caller to delete.
+func (s *DataExportStore) DeleteExpired(ctx context.Context) ([]string, error) {
+	query := `
+		DELETE FROM data_exports
+		WHERE expires_at <= $1
+		RETURNING key
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, rows.Err()
+}
+
+// UserData collects the posts, comments, relations and uploads of a user.
+func (s *DataExportStore) UserData(ctx context.Context, userID int64) (*UserData, error) {
+	ctx, cancel := context.WithTimeout(ctx, exportQueryTimeout)
+	defer cancel()
+
+	data := &UserData{}
+	var err error
+
+	if data.Posts, err = s.posts(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Comments, err = s.comments(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// followers are the users following userID
+	if data.Followers, err = s.relations(ctx, `
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1
+		ORDER BY f.created_at
+	`, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Following, err = s.relations(ctx, `
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1
+		ORDER BY f.created_at
+	`, userID); err != nil {
+		return nil, err
+	}
+
+	if data.Uploads, err = s.uploads(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *DataExportStore) posts(ctx context.Context, userID int64) ([]Post, error) {
+	query := `
+		SELECT id, user_id, title, content, tags, version, created_at, updated_at
+		FROM posts
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	ids := []int64{}
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			pq.Array(&post.Tags),
+			&post.Version,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, post)
+		ids = append(ids, post.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	attachments, err := (&AttachmentStore{s.db}).GetByPostIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := s.images(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range posts {
+		posts[i].Attachments = attachments[posts[i].ID]
+		posts[i].Images = images[posts[i].ID]
+	}
+
+	return posts, nil
+}
+
+func (s *DataExportStore) images(ctx context.Context, postIDs []int64) (map[int64][]PostImage, error) {
+	query := `
+		SELECT id, post_id, position, status, width, height, blurhash, variants, created_at
+		FROM post_images
+		WHERE post_id = ANY($1)
+		ORDER BY post_id, position
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[int64][]PostImage)
+	for rows.Next() {
+		var img PostImage
+		var variants []byte
+		if err := rows.Scan(
+			&img.ID,
+			&img.PostID,
+			&img.Position,
+			&img.Status,
+			&img.Width,
+			&img.Height,
+			&img.Blurhash,
+			&variants,
+			&img.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(variants, &img.Variants); err != nil {
+			return nil, err
+		}
+
+		images[img.PostID] = append(images[img.PostID], img)
+	}
+
+	return images, rows.Err()
+}
+
+func (s *DataExportStore) comments(ctx context.Context, userID int64) ([]Comment, error) {
+	query := `
+		SELECT id, content, user_id, post_id, created_at
+		FROM comments
+		WHERE user_id = $1
+		ORDER BY id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(
+			&comment.ID,
+			&comment.Content,
+			&comment.UserID,
+			&comment.PostID,
+			&comment.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+func (s *DataExportStore) relations(ctx context.Context, query string, userID int64) ([]Relation, error) {
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	relations := []Relation{}
+	for rows.Next() {
+		var r Relation
+		if err := rows.Scan(&r.UserID, &r.Username, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		relations = append(relations, r)
+	}
+
+	return relations, rows.Err()
+}
+
+func (s *DataExportStore) uploads(ctx context.Context, userID int64) ([]Upload, error) {
+	query := `
+		SELECT id, user_id, kind, key, content_type, size, created_at
+		FROM uploads
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []Upload{}
+	for rows.Next() {
+		var upload Upload
+		if err := rows.Scan(
+			&upload.ID,
+			&upload.UserID,
+			&upload.Kind,
+			&upload.Key,
+			&upload.ContentType,
+			&upload.Size,
+			&upload.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
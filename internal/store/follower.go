@@ -3,6 +3,8 @@ package store
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -13,20 +15,113 @@ type Follower struct {
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowEntry is a user in a followers or following list, with their
+// relation to the user viewing the list.
+type FollowEntry struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	FollowedAt  time.Time `json:"followed_at"`
+	// the user follows the viewer
+	FollowsYou bool `json:"follows_you"`
+	// the viewer follows the user
+	YouFollow bool `json:"you_follow"`
+}
+
+// FollowPage is a page of a followers or following list. NextCursor is empty
+// on the last page.
+type FollowPage struct {
+	Users      []FollowEntry `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// FollowRequest is a pending request to follow a private account.
+type FollowRequest struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// FollowRequestPage is a page of follow requests. NextCursor is empty on the
+// last page.
+type FollowRequestPage struct {
+	Requests   []FollowRequest `json:"requests"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
 type FollowerStore struct {
 	db *sql.DB
 }
 
-func (s *FollowerStore) Follow(ctx context.Context, followerId int64, userId int64) error {
+// Follow makes followerId follow userId and updates the follow counts of
+// both users. Following a private account only sends a follow request to its
+// owner, which is reported by requested.
+func (s *FollowerStore) Follow(ctx context.Context, followerId int64, userId int64) (requested bool, err error) {
+	if followerId == userId {
+		return false, ErrSelfFollow
+	}
+
+	// only active users can be followed
 	query := `
-		INSERT INTO followers (user_id, follower_id)
-		VALUES ($1, $2)
+		SELECT is_private FROM users
+		WHERE id = $1 AND is_active = true AND is_tombstone = false
+		FOR SHARE
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userId, followerId)
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var isPrivate bool
+		if err := tx.QueryRowContext(ctx, query, userId).Scan(&isPrivate); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if isPrivate {
+			requested = true
+			return requestFollow(ctx, tx, followerId, userId)
+		}
+
+		return follow(ctx, tx, followerId, userId)
+	})
+
+	return requested, err
+}
+
+func follow(ctx context.Context, tx *sql.Tx, followerId, userId int64) error {
+	query := `
+		INSERT INTO followers (user_id, follower_id)
+		VALUES ($1, $2)
+	`
+
+	if _, err := tx.ExecContext(ctx, query, userId, followerId); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+
+		return err
+	}
+
+	return updateFollowCounts(ctx, tx, followerId, userId, 1)
+}
+
+func requestFollow(ctx context.Context, tx *sql.Tx, followerId, userId int64) error {
+	// followers approved before the account turned private stay
+	query := `
+		INSERT INTO follow_requests (user_id, requester_id)
+		SELECT $1, $2
+		WHERE NOT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+	`
+
+	res, err := tx.ExecContext(ctx, query, userId, followerId)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
 			return ErrConflict
@@ -35,18 +130,339 @@ func (s *FollowerStore) Follow(ctx context.Context, followerId int64, userId int
 		return err
 	}
 
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrConflict
+	}
+
 	return nil
 }
 
+// Unfollow makes followerId stop following userId and updates the follow
+// counts of both users. A pending follow request is cancelled instead.
 func (s *FollowerStore) Unfollow(ctx context.Context, followerId int64, userId int64) error {
 	query := `
-		DELETE FROM followers 
+		DELETE FROM followers
 		WHERE user_id = $1 AND follower_id = $2
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userId, followerId)
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, userId, followerId)
+		if err != nil {
+			return err
+		}
+
+		if rows, err := res.RowsAffected(); err != nil {
+			return err
+		} else if rows > 0 {
+			return updateFollowCounts(ctx, tx, followerId, userId, -1)
+		}
+
+		err = deleteFollowRequest(ctx, tx, userId, followerId)
+		if err == ErrNotFound {
+			return notFollowing(ctx, tx, userId)
+		}
+
+		return err
+	})
+}
+
+// notFollowing tells an unknown user apart from one that is not followed.
+func notFollowing(ctx context.Context, tx *sql.Tx, userId int64) error {
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND is_active = true AND is_tombstone = false)`
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, query, userId).Scan(&exists); err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return ErrNotFollowing
+}
+
+func updateFollowCounts(ctx context.Context, tx *sql.Tx, followerId, userId int64, delta int) error {
+	query := `
+		UPDATE users SET
+			followers_count = followers_count + CASE WHEN id = $2 THEN $3 ELSE 0 END,
+			following_count = following_count + CASE WHEN id = $1 THEN $3 ELSE 0 END
+		WHERE id IN ($1, $2)
+	`
+
+	_, err := tx.ExecContext(ctx, query, followerId, userId, delta)
 	return err
 }
+
+// releaseFollows removes the follows of a user that is about to be deleted,
+// updating the follow counts of the users on the other side.
+func releaseFollows(ctx context.Context, tx *sql.Tx, userID int64) error {
+	queries := []string{
+		`UPDATE users SET following_count = following_count - 1
+		WHERE id IN (SELECT follower_id FROM followers WHERE user_id = $1)`,
+		`UPDATE users SET followers_count = followers_count - 1
+		WHERE id IN (SELECT user_id FROM followers WHERE follower_id = $1)`,
+		`DELETE FROM followers WHERE user_id = $1 OR follower_id = $1`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetFollowRequests lists the pending follow requests of userID, newest
+// first.
+func (s *FollowerStore) GetFollowRequests(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*FollowRequestPage, error) {
+	query := `
+		SELECT u.id, u.username, u.display_name, u.avatar_url, r.created_at
+		FROM follow_requests r
+		JOIN users u ON u.id = r.requester_id
+		WHERE r.user_id = $1 AND u.is_active = true
+			AND ($2::timestamptz IS NULL OR (r.created_at, r.requester_id) < ($2, $3))
+		ORDER BY r.created_at DESC, r.requester_id DESC
+		LIMIT $4
+	`
+
+	var cursorTime *time.Time
+	var cursorID int64
+	if fq.Cursor != nil {
+		cursorTime, cursorID = &fq.Cursor.CreatedAt, fq.Cursor.UserID
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// one more row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, userID, cursorTime, cursorID, fq.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &FollowRequestPage{Requests: []FollowRequest{}}
+	for rows.Next() {
+		var req FollowRequest
+		if err := rows.Scan(
+			&req.ID,
+			&req.Username,
+			&req.DisplayName,
+			&req.AvatarURL,
+			&req.RequestedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		page.Requests = append(page.Requests, req)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Requests) > fq.Limit {
+		page.Requests = page.Requests[:fq.Limit]
+
+		last := page.Requests[fq.Limit-1]
+		page.NextCursor = FollowCursor{CreatedAt: last.RequestedAt, UserID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// ApproveFollowRequest turns the follow request of requesterID into a follow
+// of userID.
+func (s *FollowerStore) ApproveFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := deleteFollowRequest(ctx, tx, userID, requesterID); err != nil {
+			return err
+		}
+
+		return follow(ctx, tx, requesterID, userID)
+	})
+}
+
+func (s *FollowerStore) RejectFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return deleteFollowRequest(ctx, tx, userID, requesterID)
+	})
+}
+
+func deleteFollowRequest(ctx context.Context, tx *sql.Tx, userID, requesterID int64) error {
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+
+	res, err := tx.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// approveFollowRequests approves all the pending follow requests of userID,
+// once the account is public, and returns the requesters now following it.
+func approveFollowRequests(ctx context.Context, tx *sql.Tx, userID int64) ([]int64, error) {
+	query := `
+		WITH approved AS (
+			DELETE FROM follow_requests WHERE user_id = $1
+			RETURNING requester_id
+		), inserted AS (
+			INSERT INTO followers (user_id, follower_id)
+			SELECT $1, requester_id FROM approved
+			ON CONFLICT DO NOTHING
+			RETURNING follower_id
+		), counted AS (
+			UPDATE users SET
+				followers_count = followers_count + CASE WHEN id = $1 THEN (SELECT COUNT(*) FROM inserted) ELSE 0 END,
+				following_count = following_count + CASE WHEN id = $1 THEN 0 ELSE 1 END
+			WHERE id = $1 OR id IN (SELECT follower_id FROM inserted)
+		)
+		SELECT follower_id FROM inserted
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requesterIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		requesterIDs = append(requesterIDs, id)
+	}
+
+	return requesterIDs, rows.Err()
+}
+
+// CanSeePosts reports whether viewerID can see the posts of userID: those of
+// a private account are only shown to its followers, and users blocking each
+// other don't see each other's posts.
+func (s *FollowerStore) CanSeePosts(ctx context.Context, userID, viewerID int64) (bool, error) {
+	query := `
+		SELECT (NOT u.is_private OR u.id = $2
+			OR EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $2))
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = u.id AND b.blocked_id = $2) OR (b.blocker_id = $2 AND b.blocked_id = u.id)
+			)
+		FROM users u
+		WHERE u.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var visible bool
+	if err := s.db.QueryRowContext(ctx, query, userID, viewerID).Scan(&visible); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return false, ErrNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return visible, nil
+}
+
+// GetFollowers lists the users following userID. With fq.Mutual only those
+// userID follows back are listed.
+func (s *FollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, fq PaginatedFollowQuery) (*FollowPage, error) {
+	return s.list(ctx, "user_id", "follower_id", userID, viewerID, fq)
+}
+
+// GetFollowing lists the users followed by userID. With fq.Mutual only those
+// following userID back are listed.
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, fq PaginatedFollowQuery) (*FollowPage, error) {
+	return s.list(ctx, "follower_id", "user_id", userID, viewerID, fq)
+}
+
+// list pages through the follows where the owner column is userID, listing
+// the users of the other column.
+func (s *FollowerStore) list(ctx context.Context, owner, other string, userID, viewerID int64, fq PaginatedFollowQuery) (*FollowPage, error) {
+	query := fmt.Sprintf(`
+		SELECT u.id, u.username, u.display_name, u.avatar_url, f.created_at,
+			EXISTS (SELECT 1 FROM followers x WHERE x.user_id = $2 AND x.follower_id = u.id) AS follows_you,
+			EXISTS (SELECT 1 FROM followers x WHERE x.user_id = u.id AND x.follower_id = $2) AS you_follow
+		FROM followers f
+		JOIN users u ON u.id = f.%[2]s
+		WHERE f.%[1]s = $1 AND u.is_active = true
+			AND ($3::timestamptz IS NULL OR (f.created_at, f.%[2]s) < ($3, $4))
+			AND (NOT $5 OR EXISTS (
+				SELECT 1 FROM followers m WHERE m.%[1]s = f.%[2]s AND m.%[2]s = f.%[1]s
+			))
+		ORDER BY f.created_at DESC, f.%[2]s DESC
+		LIMIT $6
+	`, owner, other)
+
+	var cursorTime *time.Time
+	var cursorID int64
+	if fq.Cursor != nil {
+		cursorTime, cursorID = &fq.Cursor.CreatedAt, fq.Cursor.UserID
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// one more row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, userID, viewerID, cursorTime, cursorID, fq.Mutual, fq.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &FollowPage{Users: []FollowEntry{}}
+	for rows.Next() {
+		var e FollowEntry
+		if err := rows.Scan(
+			&e.ID,
+			&e.Username,
+			&e.DisplayName,
+			&e.AvatarURL,
+			&e.FollowedAt,
+			&e.FollowsYou,
+			&e.YouFollow,
+		); err != nil {
+			return nil, err
+		}
+
+		page.Users = append(page.Users, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Users) > fq.Limit {
+		page.Users = page.Users[:fq.Limit]
+
+		last := page.Users[fq.Limit-1]
+		page.NextCursor = FollowCursor{CreatedAt: last.FollowedAt, UserID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
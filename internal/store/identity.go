@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Identity links an account of an external OpenID Connect provider to a user.
+type Identity struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Provider  string `json:"provider"`
+	Subject   string `json:"subject"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"`
+}
+
+// LoginState is what the callback of a provider login needs, found by the
+// state parameter.
+type LoginState struct {
+	Provider string
+	Nonce    string
+	Verifier string
+}
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+// GetUser returns the active user linked to the provider subject.
+func (s *IdentityStore) GetUser(ctx context.Context, provider, subject string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active
+		FROM users u
+		JOIN user_identities ui ON u.id = ui.user_id
+		WHERE ui.provider = $1 AND ui.subject = $2 AND u.is_active = true
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *IdentityStore) Link(ctx context.Context, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return createIdentity(ctx, tx, identity)
+	})
+}
+
+func createIdentity(ctx context.Context, tx *sql.Tx, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	).Scan(
+		&identity.ID,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// CreateLinkRequest stores an identity to link once the owner of the account
+// confirms it with the token.
+func (s *IdentityStore) CreateLinkRequest(ctx context.Context, identity *Identity, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		// only the latest request of an identity can be confirmed
+		query := `DELETE FROM identity_link_requests WHERE provider = $1 AND subject = $2`
+		if _, err := tx.ExecContext(ctx, query, identity.Provider, identity.Subject); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO identity_link_requests (token, user_id, provider, subject, email, expiry)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`
+
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			hashToken(token),
+			identity.UserID,
+			identity.Provider,
+			identity.Subject,
+			identity.Email,
+			time.Now().Add(exp),
+		)
+		return err
+	})
+}
+
+// ConfirmLink links the identity of the request with the token, which can
+// be used once.
+func (s *IdentityStore) ConfirmLink(ctx context.Context, token string) (*Identity, error) {
+	identity := &Identity{}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM identity_link_requests
+			WHERE token = $1 AND expiry > $2
+			RETURNING user_id, provider, subject, email
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return createIdentity(ctx, tx, identity)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// CreateLoginState keeps the secrets of a login until its callback.
+func (s *IdentityStore) CreateLoginState(ctx context.Context, state string, loginState *LoginState, exp time.Duration) error {
+	query := `
+		INSERT INTO oidc_login_states (state, provider, nonce, verifier, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		query,
+		hashToken(state),
+		loginState.Provider,
+		loginState.Nonce,
+		loginState.Verifier,
+		time.Now().Add(exp),
+	)
+	return err
+}
+
+// ConsumeLoginState returns and removes the login state, so a callback can
+// only be completed once.
+func (s *IdentityStore) ConsumeLoginState(ctx context.Context, provider, state string) (*LoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state = $1 AND provider = $2 AND expiry > $3
+		RETURNING provider, nonce, verifier
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	loginState := &LoginState{}
+	err := s.db.QueryRowContext(ctx, query, hashToken(state), provider, time.Now()).Scan(
+		&loginState.Provider,
+		&loginState.Nonce,
+		&loginState.Verifier,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return loginState, nil
+}
+
+// DeleteExpired removes the abandoned login states and link requests, and
+// returns how many were removed.
+func (s *IdentityStore) DeleteExpired(ctx context.Context) (int64, error) {
+	var deleted int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		for _, query := range []string{
+			`DELETE FROM oidc_login_states WHERE expiry <= NOW()`,
+			`DELETE FROM identity_link_requests WHERE expiry <= NOW()`,
+		} {
+			res, err := tx.ExecContext(ctx, query)
+			if err != nil {
+				return err
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			deleted += n
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LockoutPolicy locks an account for BaseDuration after MaxAttempts
+// consecutive failed logins, doubling the duration on every further lockout
+// up to MaxDuration.
+type LockoutPolicy struct {
+	MaxAttempts  int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+// Duration returns how long the nth lockout (starting at 1) lasts.
+func (p LockoutPolicy) Duration(lockouts int) time.Duration {
+	d := p.BaseDuration
+	for i := 1; i < lockouts && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+
+	return min(d, p.MaxDuration)
+}
+
+type AccountLockout struct {
+	UserID         int64      `json:"user_id"`
+	FailedAttempts int        `json:"failed_attempts"`
+	Lockouts       int        `json:"lockouts"`
+	LockedUntil    *time.Time `json:"locked_until"`
+}
+
+// IsLocked reports whether the account is locked at t.
+func (l *AccountLockout) IsLocked(t time.Time) bool {
+	return l.LockedUntil != nil && l.LockedUntil.After(t)
+}
+
+type LockoutStore struct {
+	db *sql.DB
+}
+
+func (s *LockoutStore) Get(ctx context.Context, userID int64) (*AccountLockout, error) {
+	query := `
+		SELECT user_id, failed_attempts, lockouts, locked_until
+		FROM account_lockouts
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	lockout := &AccountLockout{}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&lockout.UserID,
+		&lockout.FailedAttempts,
+		&lockout.Lockouts,
+		&lockout.LockedUntil,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return lockout, nil
+}
+
+// RecordFailure counts a failed login and locks the account once the policy
+// threshold is reached. The returned lockout has LockedUntil set when this
+// failure locked the account. Unknown users cost the same query and return
+// ErrNotFound.
+func (s *LockoutStore) RecordFailure(ctx context.Context, userID int64, policy LockoutPolicy) (*AccountLockout, error) {
+	lockout := &AccountLockout{UserID: userID}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO account_lockouts (user_id, failed_attempts)
+			SELECT id, 1 FROM users WHERE id = $1
+			ON CONFLICT (user_id) DO UPDATE
+			SET failed_attempts = account_lockouts.failed_attempts + 1, updated_at = NOW()
+			RETURNING failed_attempts, lockouts
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := tx.QueryRowContext(ctx, query, userID).Scan(&lockout.FailedAttempts, &lockout.Lockouts); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if lockout.FailedAttempts < policy.MaxAttempts {
+			return nil
+		}
+
+		lockout.Lockouts++
+		lockedUntil := time.Now().Add(policy.Duration(lockout.Lockouts))
+		lockout.FailedAttempts = 0
+		lockout.LockedUntil = &lockedUntil
+
+		query = `
+			UPDATE account_lockouts
+			SET failed_attempts = 0, lockouts = $2, locked_until = $3, updated_at = NOW()
+			WHERE user_id = $1
+		`
+
+		_, err := tx.ExecContext(ctx, query, userID, lockout.Lockouts, lockedUntil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lockout, nil
+}
+
+// Reset clears the failed attempts and any lock of an account.
+func (s *LockoutStore) Reset(ctx context.Context, userID int64) error {
+	query := `DELETE FROM account_lockouts WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type UserMFA struct {
+	UserID       int64  `json:"user_id"`
+	Secret       []byte `json:"-"`
+	Enabled      bool   `json:"enabled"`
+	LastUsedStep int64  `json:"-"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+func (s *MFAStore) GetByUserID(ctx context.Context, userID int64) (*UserMFA, error) {
+	query := `
+		SELECT user_id, secret, enabled, last_used_step, created_at, updated_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	mfa := &UserMFA{}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.Enabled,
+		&mfa.LastUsedStep,
+		&mfa.CreatedAt,
+		&mfa.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return mfa, nil
+}
+
+// SetSecret stores a pending secret. Enrolling again before verification
+// replaces it, but an enabled secret can only be removed through Disable.
+func (s *MFAStore) SetSecret(ctx context.Context, userID int64, secret []byte) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, updated_at = NOW()
+		WHERE user_mfa.enabled = false
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affectedRows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// Enable turns on a verified secret and replaces the recovery codes.
+func (s *MFAStore) Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE user_mfa SET enabled = true, last_used_step = $2, updated_at = NOW()
+			WHERE user_id = $1 AND enabled = false
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+
+		if affectedRows, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affectedRows == 0 {
+			return ErrConflict
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		for _, code := range recoveryCodes {
+			query := `INSERT INTO user_recovery_codes (user_id, code) VALUES ($1, $2)`
+			if _, err := tx.ExecContext(ctx, query, userID, hashToken(code)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *MFAStore) Disable(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// UseStep records a successfully used time step so the same code can not be
+// replayed. It returns ErrConflict when the step was already used.
+func (s *MFAStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	query := `
+		UPDATE user_mfa SET last_used_step = $2, updated_at = NOW()
+		WHERE user_id = $1 AND last_used_step < $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affectedRows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes a single-use recovery code.
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `
+		UPDATE user_recovery_codes SET used_at = $3
+		WHERE user_id = $1 AND code = $2 AND used_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, hashToken(code), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affectedRows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -10,7 +10,24 @@ type MockUserStore struct{}
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:            &MockUserStore{},
+		Posts:            &MockPostStore{},
+		PostImages:       &MockPostImageStore{},
+		PostRevisions:    &MockPostRevisionStore{},
+		Attachments:      &MockAttachmentStore{},
+		Sessions:         &MockSessionStore{},
+		RevokedTokens:    &MockRevokedTokenStore{},
+		MFA:              &MockMFAStore{},
+		PersonalTokens:   &MockPersonalTokenStore{},
+		Identities:       &MockIdentityStore{},
+		Lockouts:         &MockLockoutStore{},
+		Uploads:          &MockUploadStore{},
+		DataExports:      &MockDataExportStore{},
+		AccountDeletions: &MockAccountDeletionStore{},
+		Followers:        &MockFollowerStore{},
+		Blocks:           &MockBlockStore{},
+		Mutes:            &MockMuteStore{},
+		Suggestions:      &MockSuggestionStore{},
 	}
 }
 
@@ -18,6 +35,14 @@ func (m *MockUserStore) Create(ctx context.Context, tx *sql.Tx, u *User) error {
 	return nil
 }
 
+func (m *MockUserStore) DeleteAccount(ctx context.Context, userID int64, mode string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *MockUserStore) Search(ctx context.Context, viewerID int64, sq UserSearchQuery) ([]UserSearchResult, error) {
+	return []UserSearchResult{{ID: 2, Username: sq.Query, YouFollow: true}}, nil
+}
+
 func (m *MockUserStore) GetById(ctx context.Context, userID int64) (*User, error) {
 	return &User{ID: userID}, nil
 }
@@ -30,6 +55,12 @@ func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *User, token s
 	return nil
 }
 
+func (m *MockUserStore) CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	user.ID = 1
+	identity.UserID = user.ID
+	return nil
+}
+
 func (m *MockUserStore) Activate(ctx context.Context, t string) error {
 	return nil
 }
@@ -37,3 +68,438 @@ func (m *MockUserStore) Activate(ctx context.Context, t string) error {
 func (m *MockUserStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
+
+func (m *MockUserStore) Reinvite(ctx context.Context, email string, token string, exp time.Duration) (*User, error) {
+	return &User{ID: 1, Email: email}, nil
+}
+
+func (m *MockUserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) DeleteInactive(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ResetPassword(ctx context.Context, token string, newPassword string) (*User, error) {
+	return &User{ID: 1}, nil
+}
+
+func (m *MockUserStore) Update(ctx context.Context, user *User) ([]int64, error) {
+	user.Version++
+	return nil, nil
+}
+
+func (m *MockUserStore) CreateEmailChange(ctx context.Context, userID int64, newEmail string, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	return &User{ID: 1}, nil
+}
+
+type MockSessionStore struct{}
+
+func (m *MockSessionStore) Create(ctx context.Context, s *Session, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockSessionStore) Rotate(ctx context.Context, oldToken, newToken string, exp time.Duration) (*Session, error) {
+	return &Session{UserID: 1}, nil
+}
+
+func (m *MockSessionStore) Revoke(ctx context.Context, token string) error {
+	return nil
+}
+
+func (m *MockSessionStore) RevokeAll(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockRevokedTokenStore struct{}
+
+func (m *MockRevokedTokenStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	return nil
+}
+
+func (m *MockRevokedTokenStore) RevokeAll(ctx context.Context, userID int64, before time.Time) error {
+	return nil
+}
+
+func (m *MockRevokedTokenStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	return false, nil
+}
+
+func (m *MockRevokedTokenStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+type MockMFAStore struct{}
+
+func (m *MockMFAStore) GetByUserID(ctx context.Context, userID int64) (*UserMFA, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockMFAStore) SetSecret(ctx context.Context, userID int64, secret []byte) error {
+	return nil
+}
+
+func (m *MockMFAStore) Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error {
+	return nil
+}
+
+func (m *MockMFAStore) Disable(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockMFAStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	return nil
+}
+
+func (m *MockMFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	return nil
+}
+
+type MockPersonalTokenStore struct{}
+
+func (m *MockPersonalTokenStore) Create(ctx context.Context, pat *PersonalAccessToken, token string, expiry time.Time) error {
+	return nil
+}
+
+func (m *MockPersonalTokenStore) GetByUserID(ctx context.Context, userID int64) ([]PersonalAccessToken, error) {
+	return []PersonalAccessToken{}, nil
+}
+
+// Authenticate accepts any token and grants it read access to posts only.
+func (m *MockPersonalTokenStore) Authenticate(ctx context.Context, token string) (*PersonalAccessToken, error) {
+	return &PersonalAccessToken{ID: 1, UserID: 1, Scopes: []string{ScopePostsRead}}, nil
+}
+
+func (m *MockPersonalTokenStore) Delete(ctx context.Context, userID int64, tokenID int64) error {
+	return nil
+}
+
+func (m *MockPersonalTokenStore) DeleteAll(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockIdentityStore struct{}
+
+func (m *MockIdentityStore) GetUser(ctx context.Context, provider, subject string) (*User, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockIdentityStore) Link(ctx context.Context, identity *Identity) error {
+	return nil
+}
+
+func (m *MockIdentityStore) CreateLinkRequest(ctx context.Context, identity *Identity, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockIdentityStore) ConfirmLink(ctx context.Context, token string) (*Identity, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockIdentityStore) CreateLoginState(ctx context.Context, state string, loginState *LoginState, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockIdentityStore) ConsumeLoginState(ctx context.Context, provider, state string) (*LoginState, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockIdentityStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+type MockLockoutStore struct{}
+
+func (m *MockLockoutStore) Get(ctx context.Context, userID int64) (*AccountLockout, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockLockoutStore) RecordFailure(ctx context.Context, userID int64, policy LockoutPolicy) (*AccountLockout, error) {
+	return &AccountLockout{UserID: userID, FailedAttempts: 1}, nil
+}
+
+func (m *MockLockoutStore) Reset(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockUploadStore struct{}
+
+func (m *MockUploadStore) Create(ctx context.Context, upload *Upload) error {
+	return nil
+}
+
+func (m *MockUploadStore) GetByID(ctx context.Context, id string) (*Upload, error) {
+	return &Upload{ID: id, UserID: 1, Kind: UploadKindAttachment, Key: "attachments/1/" + id + ".png", ContentType: "image/png"}, nil
+}
+
+func (m *MockUploadStore) Delete(ctx context.Context, userID int64, id string) (string, error) {
+	return "attachments/1/" + id + ".png", nil
+}
+
+type MockPostStore struct{}
+
+func (m *MockPostStore) Create(ctx context.Context, post *Post) error {
+	post.ID = 1
+	for i := range post.Attachments {
+		post.Attachments[i].ID = int64(i + 1)
+		post.Attachments[i].PostID = post.ID
+		post.Attachments[i].Position = i
+	}
+	for i := range post.Images {
+		post.Images[i].ID = int64(i + 1)
+		post.Images[i].PostID = post.ID
+		post.Images[i].Position = i
+		post.Images[i].Status = PostImagePending
+	}
+	return nil
+}
+
+// GetById mocks post 2 as a draft of user 2. The other posts were edited
+// twice.
+func (m *MockPostStore) GetById(ctx context.Context, id int64) (*Post, error) {
+	if id == 2 {
+		return &Post{ID: id, UserID: 2, Status: PostStatusDraft}, nil
+	}
+	editedAt := time.Now()
+	return &Post{
+		ID:       id,
+		UserID:   1,
+		Title:    "hello",
+		Content:  "hello big world",
+		Version:  2,
+		Status:   PostStatusPublished,
+		EditedAt: &editedAt,
+		Edited:   true,
+	}, nil
+}
+
+func (m *MockPostStore) Delete(ctx context.Context, id int64) ([]string, error) {
+	return nil, nil
+}
+
+func (m *MockPostStore) Update(ctx context.Context, post *Post, editorID int64) error {
+	return nil
+}
+
+func (m *MockPostStore) GetFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+
+func (m *MockPostStore) GetDrafts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{{Post: Post{ID: 2, UserID: userID, Status: PostStatusDraft}}}, nil
+}
+
+func (m *MockPostStore) PublishDue(ctx context.Context, limit int) ([]int64, error) {
+	return nil, nil
+}
+
+func (m *MockPostStore) GetUserPosts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{{Post: Post{ID: 1, UserID: userID}, CommentsCount: 2}}, nil
+}
+
+type MockPostImageStore struct{}
+
+func (m *MockPostImageStore) GetByPostID(ctx context.Context, postID int64) ([]PostImage, error) {
+	return []PostImage{}, nil
+}
+
+func (m *MockPostImageStore) ClaimPending(ctx context.Context, limit int, staleAfter time.Duration) ([]PostImage, error) {
+	return nil, nil
+}
+
+func (m *MockPostImageStore) Complete(ctx context.Context, img *PostImage) error {
+	return nil
+}
+
+func (m *MockPostImageStore) Fail(ctx context.Context, img *PostImage, reason string) error {
+	return nil
+}
+
+type MockPostRevisionStore struct{}
+
+func (m *MockPostRevisionStore) GetByPostID(ctx context.Context, postID int64) ([]PostRevision, error) {
+	editorID := int64(1)
+	return []PostRevision{
+		{PostID: postID, Version: 1, Title: "hello", Content: "hello there world", EditedBy: &editorID},
+		{PostID: postID, Version: 0, Title: "hi", Content: "hello world", EditedBy: &editorID},
+	}, nil
+}
+
+type MockAttachmentStore struct{}
+
+func (m *MockAttachmentStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Attachment, error) {
+	return map[int64][]Attachment{}, nil
+}
+
+type MockDataExportStore struct{}
+
+func (m *MockDataExportStore) Create(ctx context.Context, export *DataExport, exp time.Duration) error {
+	export.ID = 1
+	export.Status = DataExportPending
+	export.ExpiresAt = time.Now().Add(exp)
+	return nil
+}
+
+func (m *MockDataExportStore) ClaimPending(ctx context.Context, limit int, staleAfter time.Duration) ([]DataExport, error) {
+	return nil, nil
+}
+
+func (m *MockDataExportStore) Complete(ctx context.Context, export *DataExport, token string) error {
+	export.Status = DataExportReady
+	return nil
+}
+
+func (m *MockDataExportStore) Fail(ctx context.Context, export *DataExport, reason string) error {
+	export.Status = DataExportFailed
+	return nil
+}
+
+func (m *MockDataExportStore) GetByToken(ctx context.Context, token string) (*DataExport, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockDataExportStore) DeleteExpired(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (m *MockDataExportStore) UserData(ctx context.Context, userID int64) (*UserData, error) {
+	return &UserData{
+		Posts:     []Post{{ID: 1, UserID: userID, Title: "hello"}},
+		Comments:  []Comment{},
+		Followers: []Relation{},
+		Following: []Relation{},
+		Uploads:   []Upload{{ID: "6f1c2a5e-3f5b-4c1e-9a4e-2b7c8d9e0f11", UserID: userID, Kind: UploadKindAvatar, Key: "avatars/1/avatar.png"}},
+	}, nil
+}
+
+type MockAccountDeletionStore struct{}
+
+func (m *MockAccountDeletionStore) Schedule(ctx context.Context, deletion *AccountDeletion, gracePeriod time.Duration) error {
+	deletion.RequestedAt = time.Now()
+	deletion.ScheduledAt = deletion.RequestedAt.Add(gracePeriod)
+	return nil
+}
+
+func (m *MockAccountDeletionStore) Get(ctx context.Context, userID int64) (*AccountDeletion, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockAccountDeletionStore) Cancel(ctx context.Context, userID int64) error {
+	return ErrNotFound
+}
+
+func (m *MockAccountDeletionStore) Due(ctx context.Context, limit int) ([]AccountDeletion, error) {
+	return nil, nil
+}
+
+type MockFollowerStore struct{}
+
+// Follow mocks user 3 as a private account.
+func (m *MockFollowerStore) Follow(ctx context.Context, followerID int64, userID int64) (bool, error) {
+	if followerID == userID {
+		return false, ErrSelfFollow
+	}
+	return userID == 3, nil
+}
+
+// Unfollow mocks the caller following only user 2.
+func (m *MockFollowerStore) Unfollow(ctx context.Context, followerID int64, userID int64) error {
+	if userID != 2 {
+		return ErrNotFollowing
+	}
+	return nil
+}
+
+func (m *MockFollowerStore) GetFollowers(ctx context.Context, userID, viewerID int64, fq PaginatedFollowQuery) (*FollowPage, error) {
+	return &FollowPage{Users: []FollowEntry{{ID: 2, Username: "follower", YouFollow: true}}}, nil
+}
+
+func (m *MockFollowerStore) GetFollowing(ctx context.Context, userID, viewerID int64, fq PaginatedFollowQuery) (*FollowPage, error) {
+	return &FollowPage{Users: []FollowEntry{}}, nil
+}
+
+func (m *MockFollowerStore) GetFollowRequests(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*FollowRequestPage, error) {
+	return &FollowRequestPage{Requests: []FollowRequest{{ID: 3, Username: "requester"}}}, nil
+}
+
+// ApproveFollowRequest never finds the request, approving it would email the
+// requester.
+func (m *MockFollowerStore) ApproveFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	return ErrNotFound
+}
+
+func (m *MockFollowerStore) RejectFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	if requesterID != 3 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CanSeePosts mocks the posts of the blocked user 4 as hidden.
+func (m *MockFollowerStore) CanSeePosts(ctx context.Context, userID, viewerID int64) (bool, error) {
+	return userID != 4 && viewerID != 4, nil
+}
+
+// MockBlockStore mocks user 4 as blocked by the caller.
+type MockBlockStore struct{}
+
+func (m *MockBlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+	if blockedID == 4 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (m *MockBlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	if blockedID != 4 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MockBlockStore) GetBlocked(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*RestrictedUserPage, error) {
+	return &RestrictedUserPage{Users: []RestrictedUser{{ID: 4, Username: "blocked"}}}, nil
+}
+
+func (m *MockBlockStore) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	return userID == 4 || otherID == 4, nil
+}
+
+type MockMuteStore struct{}
+
+func (m *MockMuteStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	if muterID == mutedID {
+		return ErrSelfMute
+	}
+	return nil
+}
+
+func (m *MockMuteStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	return ErrNotFound
+}
+
+func (m *MockMuteStore) GetMuted(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*RestrictedUserPage, error) {
+	return &RestrictedUserPage{Users: []RestrictedUser{}}, nil
+}
+
+type MockSuggestionStore struct{}
+
+func (m *MockSuggestionStore) GetSuggestions(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	suggestions := []Suggestion{}
+	for id := int64(2); id < 6 && len(suggestions) < limit; id++ {
+		suggestions = append(suggestions, Suggestion{ID: id, Score: float64(10 - id)})
+	}
+	return suggestions, nil
+}
@@ -1,6 +1,9 @@
 package store
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -78,3 +81,113 @@ func parseTime(s string) string {
 
 	return t.Format(time.DateTime)
 }
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FollowCursor is the position after the last entry of a followers or
+// following page, which is sorted by follow date then user ID, newest first.
+type FollowCursor struct {
+	CreatedAt time.Time
+	UserID    int64
+}
+
+// Encode returns the cursor as an opaque string for clients.
+func (c FollowCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d", c.CreatedAt.Unix(), c.UserID))
+}
+
+type PaginatedFollowQuery struct {
+	Limit  int  `json:"limit" validate:"gte=1,lte=100"`
+	Mutual bool `json:"mutual"`
+	// nil for the first page
+	Cursor *FollowCursor `json:"-"`
+}
+
+func (fq PaginatedFollowQuery) Parse(r *http.Request) (PaginatedFollowQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Limit = l
+	}
+
+	if mutual := qs.Get("mutual"); mutual != "" {
+		m, err := strconv.ParseBool(mutual)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Mutual = m
+	}
+
+	if cursor := qs.Get("cursor"); cursor != "" {
+		c, err := parseFollowCursor(cursor)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Cursor = c
+	}
+
+	return fq, nil
+}
+
+func parseFollowCursor(s string) (*FollowCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	unix, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	sec, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &FollowCursor{CreatedAt: time.Unix(sec, 0), UserID: userID}, nil
+}
+
+type UserSearchQuery struct {
+	Query  string `json:"q" validate:"required,max=100"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (sq UserSearchQuery) Parse(r *http.Request) (UserSearchQuery, error) {
+	qs := r.URL.Query()
+
+	sq.Query = strings.TrimSpace(qs.Get("q"))
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.Offset = o
+	}
+
+	return sq, nil
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// scopes a personal access token can be granted
+const (
+	ScopePostsRead     = "posts:read"
+	ScopePostsWrite    = "posts:write"
+	ScopeCommentsWrite = "comments:write"
+	ScopeFollowsWrite  = "follows:write"
+	ScopeFollowsRead   = "follows:read"
+	ScopeFeedRead      = "feed:read"
+	ScopeUsersRead     = "users:read"
+)
+
+type PersonalAccessToken struct {
+	ID         int64    `json:"id"`
+	UserID     int64    `json:"user_id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	Expiry     *string  `json:"expiry"`
+	LastUsedAt *string  `json:"last_used_at"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type PersonalTokenStore struct {
+	db *sql.DB
+}
+
+// Create stores the token; a zero expiry means the token never expires.
+func (s *PersonalTokenStore) Create(ctx context.Context, pat *PersonalAccessToken, token string, expiry time.Time) error {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token, scopes, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, expiry, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var exp sql.NullTime
+	if !expiry.IsZero() {
+		exp = sql.NullTime{Time: expiry, Valid: true}
+	}
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		pat.UserID,
+		pat.Name,
+		hashToken(token),
+		pq.Array(pat.Scopes),
+		exp,
+	).Scan(
+		&pat.ID,
+		&pat.Expiry,
+		&pat.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PersonalTokenStore) GetByUserID(ctx context.Context, userID int64) ([]PersonalAccessToken, error) {
+	query := `
+		SELECT id, user_id, name, scopes, expiry, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		var pat PersonalAccessToken
+		if err := rows.Scan(
+			&pat.ID,
+			&pat.UserID,
+			&pat.Name,
+			pq.Array(&pat.Scopes),
+			&pat.Expiry,
+			&pat.LastUsedAt,
+			&pat.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, pat)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Authenticate looks up an unexpired token and records its use.
+func (s *PersonalTokenStore) Authenticate(ctx context.Context, token string) (*PersonalAccessToken, error) {
+	query := `
+		UPDATE personal_access_tokens SET last_used_at = NOW()
+		WHERE token = $1 AND (expiry IS NULL OR expiry > $2)
+		RETURNING id, user_id, name, scopes, expiry, last_used_at, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	pat := &PersonalAccessToken{}
+	err := s.db.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+		&pat.ID,
+		&pat.UserID,
+		&pat.Name,
+		pq.Array(&pat.Scopes),
+		&pat.Expiry,
+		&pat.LastUsedAt,
+		&pat.CreatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return pat, nil
+}
+
+// DeleteAll revokes every personal access token of a user.
+func (s *PersonalTokenStore) DeleteAll(ctx context.Context, userID int64) error {
+	query := `DELETE FROM personal_access_tokens WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (s *PersonalTokenStore) Delete(ctx context.Context, userID int64, tokenID int64) error {
+	query := `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, tokenID, userID)
+	if err != nil {
+		return err
+	}
+
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affectedRows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -4,10 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
 type Post struct {
 	ID        int64     `json:"id"`
 	Title     string    `json:"title"`
@@ -17,8 +24,20 @@ type Post struct {
 	Version   int       `json:"version"`
 	CreatedAt string    `json:"created_at"`
 	UpdatedAt string    `json:"updated_at"`
-	Comments  []Comment `json:"comments"`
+	// only published posts are shown to other users
+	Status string `json:"status"`
+	// when a scheduled post gets published
+	PublishAt   *time.Time `json:"publish_at"`
+	PublishedAt *time.Time `json:"published_at"`
+	// last change of the title or content once published, older versions
+	// are kept as revisions
+	EditedAt *time.Time `json:"edited_at"`
+	Edited   bool       `json:"edited"`
+	Comments []Comment  `json:"comments"`
 	Users     User      `json:"user"`
+	// images and their processing status, in display order
+	Images      []PostImage  `json:"images"`
+	Attachments []Attachment `json:"attachments"`
 }
 
 type PostWithMetadata struct {
@@ -32,37 +51,58 @@ type PostStore struct {
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	query := `
-		INSERT INTO posts (title, content, user_id, tags)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated_at
+		INSERT INTO posts (title, content, user_id, tags, status, publish_at, published_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $5::varchar = 'published' THEN NOW() END)
+		RETURNING id, created_at, updated_at, published_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Title,
-		post.Content,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
-	if err != nil {
-		return err
-	}
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			post.UserID,
+			pq.Array(post.Tags),
+			post.Status,
+			post.PublishAt,
+		).Scan(
+			&post.ID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.PublishedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if post.Status == PostStatusPublished {
+			if err := updatePostsCount(ctx, tx, post.UserID, 1); err != nil {
+				return err
+			}
+		}
+
+		if err := createPostImages(ctx, tx, post); err != nil {
+			return err
+		}
 
-	return nil
+		return createAttachments(ctx, tx, post)
+	})
+}
 
+// updatePostsCount moves the published posts count of a user by delta, in
+// the transaction publishing or removing the posts.
+func updatePostsCount(ctx context.Context, tx *sql.Tx, userID int64, delta int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE users SET posts_count = posts_count + $2 WHERE id = $1`, userID, delta)
+	return err
 }
 
 func (s *PostStore) GetById(ctx context.Context, id int64) (*Post, error) {
 	query := `
-		SELECT id, user_id, title, content, tags, version, created_at, updated_at 
+		SELECT id, user_id, title, content, tags, version, created_at, updated_at, status, publish_at, published_at, edited_at
 		FROM  posts
 		WHERE id = $1
 	`
@@ -80,6 +120,10 @@ func (s *PostStore) GetById(ctx context.Context, id int64) (*Post, error) {
 		&post.Version,
 		&post.CreatedAt,
 		&post.UpdatedAt,
+		&post.Status,
+		&post.PublishAt,
+		&post.PublishedAt,
+		&post.EditedAt,
 	); err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -89,67 +133,185 @@ func (s *PostStore) GetById(ctx context.Context, id int64) (*Post, error) {
 		}
 	}
 
+	post.Edited = post.EditedAt != nil
+
 	return &post, nil
 }
 
-func (s *PostStore) Delete(ctx context.Context, postId int64) error {
-	query := `DELETE FROM posts WHERE id = $1`
+// Delete removes a post together with its comments, images and attachments,
+// and returns the keys of the blobs they referenced for the caller to delete.
+// The originals of images not processed yet are removed with their uploads.
+func (s *PostStore) Delete(ctx context.Context, postId int64) ([]string, error) {
+	// images are locked so one completing concurrently sees the post deleted
+	// and removes its own variants
+	keysQuery := `
+		SELECT key FROM attachments WHERE post_id = $1
+		UNION ALL
+		SELECT v.value
+		FROM (SELECT variants FROM post_images WHERE post_id = $1 FOR UPDATE) i,
+			jsonb_each_text(i.variants) v
+		UNION ALL
+		SELECT source_key FROM post_images WHERE post_id = $1 AND status <> 'ready'
+	`
+
+	// processed images already removed their upload
+	uploadsQuery := `
+		DELETE FROM uploads
+		WHERE id IN (SELECT upload_id FROM post_images WHERE post_id = $1 AND status <> 'ready')
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	res, err := s.db.ExecContext(ctx, query, postId)
-	if err != nil {
-		return err
-	}
+	var keys []string
 
-	if affectedRows, err := res.RowsAffected(); err != nil {
-		return err
-	} else if affectedRows == 0 {
-		return ErrNotFound
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, keysQuery, postId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, uploadsQuery, postId); err != nil {
+			return err
+		}
+
+		var post Post
+		err = tx.QueryRowContext(ctx, `DELETE FROM posts WHERE id = $1 RETURNING user_id, status`, postId).Scan(&post.UserID, &post.Status)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if post.Status == PostStatusPublished {
+			return updatePostsCount(ctx, tx, post.UserID, -1)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return keys, nil
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
+// Update saves the title, content and status of a post if it is still at
+// post.Version. The previous title and content are kept as a revision when
+// they change, in the same transaction.
+func (s *PostStore) Update(ctx context.Context, post *Post, editorID int64) error {
 	query := `
 		UPDATE posts 
-		SET title = $1, content = $2 , version = version + 1
+		SET title = $1, content = $2, status = $5, publish_at = $6,
+			published_at = CASE WHEN $5::varchar = 'published' THEN COALESCE(published_at, NOW()) END,
+			edited_at = CASE WHEN $7 THEN NOW() ELSE edited_at END,
+			version = version + 1
 		WHERE id = $3 AND version = $4
-		RETURNING version
+		RETURNING version, published_at, edited_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var prev Post
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT user_id, title, content, status FROM posts WHERE id = $1 AND version = $2 FOR UPDATE`,
+			post.ID,
+			post.Version,
+		).Scan(&prev.UserID, &prev.Title, &prev.Content, &prev.Status)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		// status changes alone are not edits
+		edited := prev.Title != post.Title || prev.Content != post.Content
+		if edited {
+			rev := &PostRevision{
+				PostID:   post.ID,
+				Version:  post.Version,
+				Title:    prev.Title,
+				Content:  prev.Content,
+				EditedBy: &editorID,
+			}
+			if err := createPostRevision(ctx, tx, rev); err != nil {
+				return err
+			}
+		}
+
+		// drafts can be reworked until published without being marked
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			post.ID,
+			post.Version,
+			post.Status,
+			post.PublishAt,
+			edited && prev.Status == PostStatusPublished,
+		).Scan(&post.Version, &post.PublishedAt, &post.EditedAt); err != nil {
 			return err
 		}
-	}
 
-	return nil
+		post.Edited = post.EditedAt != nil
+
+		switch {
+		case post.Status == PostStatusPublished && prev.Status != PostStatusPublished:
+			return updatePostsCount(ctx, tx, prev.UserID, 1)
+		case post.Status != PostStatusPublished && prev.Status == PostStatusPublished:
+			return updatePostsCount(ctx, tx, prev.UserID, -1)
+		}
+
+		return nil
+	})
 }
 
 func (s *PostStore) GetFeed(ctx context.Context, userId int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
 
 	query := `
-		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username, COUNT(c.id) AS comments_count
+		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, p.edited_at, u.username, COUNT(c.id) AS comments_count
 		FROM posts p
 		LEFT JOIN comments c ON c.post_id = p.id
 		LEFT JOIN users u ON p.user_id = u.id
 		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
 		WHERE
 			f.user_id = $1 AND
+			p.status = 'published' AND
+			(NOT u.is_private OR p.user_id = $1 OR EXISTS (
+				SELECT 1 FROM followers pf WHERE pf.user_id = p.user_id AND pf.follower_id = $1
+			)) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+			) AND
+			NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id) AND
 			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
 			(p.tags @> $5 OR $5 = '{}')
 		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
+		ORDER BY p.published_at ` + fq.Sort + `
 		LIMIT $2 OFFSET $3
 	`
 
@@ -174,13 +336,141 @@ func (s *PostStore) GetFeed(ctx context.Context, userId int64, fq PaginatedFeedQ
 			&post.CreatedAt,
 			&post.Version,
 			pq.Array(&post.Tags),
+			&post.EditedAt,
 			&post.Users.Username,
 			&post.CommentsCount,
 		); err != nil {
 			return nil, err
 		}
+		post.Edited = post.EditedAt != nil
 		posts = append(posts, &post)
 	}
 
 	return posts, nil
 }
+
+// GetUserPosts lists the published posts of userID with their comment
+// counts, filtered like the feed. Whether the caller may see them is checked
+// by the caller.
+func (s *PostStore) GetUserPosts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return s.listUserPosts(ctx, userID, []string{PostStatusPublished}, fq)
+}
+
+// GetDrafts lists the draft and scheduled posts of userID.
+func (s *PostStore) GetDrafts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return s.listUserPosts(ctx, userID, []string{PostStatusDraft, PostStatusScheduled}, fq)
+}
+
+func (s *PostStore) listUserPosts(ctx context.Context, userID int64, statuses []string, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	// unpublished posts are sorted by creation
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			p.status, p.publish_at, p.published_at, p.edited_at, u.username, COUNT(c.id) AS comments_count
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		LEFT JOIN comments c ON c.post_id = p.id
+		WHERE
+			p.user_id = $1 AND
+			p.status = ANY ($8) AND
+			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+			(p.tags @> $5 OR $5 = '{}') AND
+			(NULLIF($6, '')::timestamp IS NULL OR COALESCE(p.published_at, p.created_at) >= NULLIF($6, '')::timestamp) AND
+			(NULLIF($7, '')::timestamp IS NULL OR COALESCE(p.published_at, p.created_at) <= NULLIF($7, '')::timestamp)
+		GROUP BY p.id, u.username
+		ORDER BY COALESCE(p.published_at, p.created_at) ` + fq.Sort + `, p.id ` + fq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		userID,
+		fq.Limit,
+		fq.Offset,
+		fq.Search,
+		pq.Array(fq.Tags),
+		fq.Since,
+		fq.Until,
+		pq.Array(statuses),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*PostWithMetadata{}
+	for rows.Next() {
+		var post PostWithMetadata
+		if err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.Status,
+			&post.PublishAt,
+			&post.PublishedAt,
+			&post.EditedAt,
+			&post.Users.Username,
+			&post.CommentsCount,
+		); err != nil {
+			return nil, err
+		}
+		post.Edited = post.EditedAt != nil
+		posts = append(posts, &post)
+	}
+
+	return posts, rows.Err()
+}
+
+// PublishDue publishes up to limit scheduled posts whose time has come and
+// returns their IDs. Posts locked by a concurrent call are skipped, so each
+// post is published exactly once however many schedulers run.
+func (s *PostStore) PublishDue(ctx context.Context, limit int) ([]int64, error) {
+	// the posts counts of the authors are updated by the same statement
+	query := `
+		WITH published AS (
+			UPDATE posts
+			SET status = 'published', published_at = publish_at, version = version + 1
+			WHERE id IN (
+				SELECT id FROM posts
+				WHERE status = 'scheduled' AND publish_at <= NOW()
+				ORDER BY publish_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			) AND status = 'scheduled'
+			RETURNING id, user_id
+		), counted AS (
+			UPDATE users u
+			SET posts_count = u.posts_count + c.n
+			FROM (SELECT user_id, COUNT(*) AS n FROM published GROUP BY user_id) c
+			WHERE u.id = c.user_id
+		)
+		SELECT id FROM published
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
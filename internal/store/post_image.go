@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	PostImagePending    = "pending"
+	PostImageProcessing = "processing"
+	PostImageReady      = "ready"
+	PostImageFailed     = "failed"
+)
+
+// PostImage is an image attached to a post. It is created pending with the
+// uploaded original and processed in the background into its variants.
+type PostImage struct {
+	ID        int64  `json:"id"`
+	PostID    int64  `json:"post_id"`
+	UserID    int64  `json:"-"`
+	UploadID  string `json:"-"`
+	SourceKey string `json:"-"`
+	Position  int    `json:"position"`
+	Status    string `json:"status"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Blurhash  string `json:"blurhash,omitempty"`
+	// blob keys of the variants by size name
+	Variants map[string]string `json:"-"`
+	// signed URLs of the variants, set when the image is returned to a client
+	URLs      map[string]string `json:"urls,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Attempts  int               `json:"-"`
+	CreatedAt string            `json:"created_at"`
+}
+
+type PostImageStore struct {
+	db *sql.DB
+}
+
+func createPostImages(ctx context.Context, tx *sql.Tx, post *Post) error {
+	query := `
+		INSERT INTO post_images (post_id, user_id, upload_id, source_key, position)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at
+	`
+
+	for i := range post.Images {
+		img := &post.Images[i]
+		img.PostID = post.ID
+		img.UserID = post.UserID
+		img.Position = i
+
+		if err := tx.QueryRowContext(
+			ctx,
+			query,
+			img.PostID,
+			img.UserID,
+			img.UploadID,
+			img.SourceKey,
+			img.Position,
+		).Scan(&img.ID, &img.Status, &img.CreatedAt); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *PostImageStore) GetByPostID(ctx context.Context, postID int64) ([]PostImage, error) {
+	query := `
+		SELECT id, post_id, user_id, position, status, width, height, blurhash, variants, error, created_at
+		FROM post_images
+		WHERE post_id = $1
+		ORDER BY position
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []PostImage{}
+	for rows.Next() {
+		var img PostImage
+		var variants []byte
+		if err := rows.Scan(
+			&img.ID,
+			&img.PostID,
+			&img.UserID,
+			&img.Position,
+			&img.Status,
+			&img.Width,
+			&img.Height,
+			&img.Blurhash,
+			&variants,
+			&img.Error,
+			&img.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(variants, &img.Variants); err != nil {
+			return nil, err
+		}
+
+		images = append(images, img)
+	}
+
+	return images, rows.Err()
+}
+
+// ClaimPending marks up to limit pending images as processing and returns
+// them. Images left processing for longer than staleAfter, by a worker that
+// died, are claimed again. Concurrent workers never claim the same image.
+func (s *PostImageStore) ClaimPending(ctx context.Context, limit int, staleAfter time.Duration) ([]PostImage, error) {
+	query := `
+		UPDATE post_images
+		SET status = 'processing', attempts = attempts + 1, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM post_images
+			WHERE status = 'pending'
+				OR (status = 'processing' AND updated_at < NOW() - $2 * interval '1 second')
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, post_id, user_id, upload_id, source_key, position, status, attempts, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, int64(staleAfter.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []PostImage
+	for rows.Next() {
+		var img PostImage
+		if err := rows.Scan(
+			&img.ID,
+			&img.PostID,
+			&img.UserID,
+			&img.UploadID,
+			&img.SourceKey,
+			&img.Position,
+			&img.Status,
+			&img.Attempts,
+			&img.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		images = append(images, img)
+	}
+
+	return images, rows.Err()
+}
+
+// Complete stores the result of processing an image and removes the upload
+// of its original, whose blob the caller deletes. It returns ErrNotFound
+// when the claim was lost: the post was deleted, or the image went stale and
+// was claimed again.
+func (s *PostImageStore) Complete(ctx context.Context, img *PostImage) error {
+	variants, err := json.Marshal(img.Variants)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE post_images
+			SET status = 'ready', width = $2, height = $3, blurhash = $4, variants = $5, error = '', updated_at = NOW()
+			WHERE id = $1 AND status = 'processing' AND attempts = $6
+		`
+
+		res, err := tx.ExecContext(ctx, query, img.ID, img.Width, img.Height, img.Blurhash, string(variants), img.Attempts)
+		if err != nil {
+			return err
+		}
+
+		if rows, err := res.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM uploads WHERE id = $1`, img.UploadID); err != nil {
+			return err
+		}
+
+		img.Status = PostImageReady
+
+		return nil
+	})
+}
+
+// Fail gives up on an image, returning ErrNotFound like Complete when the
+// claim was lost.
+func (s *PostImageStore) Fail(ctx context.Context, img *PostImage, reason string) error {
+	query := `
+		UPDATE post_images
+		SET status = 'failed', error = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'processing' AND attempts = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, img.ID, reason, img.Attempts)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrNotFound
+	}
+
+	img.Status = PostImageFailed
+
+	return nil
+}
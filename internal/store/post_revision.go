@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostRevision is the title and content of a post at Version, recorded when
+// they were edited.
+type PostRevision struct {
+	PostID  int64  `json:"post_id"`
+	Version int    `json:"version"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// who made the edit replacing this revision, nil once deleted
+	EditedBy *int64 `json:"edited_by"`
+	// when this revision was replaced
+	EditedAt time.Time `json:"edited_at"`
+}
+
+type PostRevisionStore struct {
+	db *sql.DB
+}
+
+// GetByPostID lists the revisions of a post, newest first.
+func (s *PostRevisionStore) GetByPostID(ctx context.Context, postID int64) ([]PostRevision, error) {
+	query := `
+		SELECT post_id, version, title, content, edited_by, created_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY version DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		if err := rows.Scan(
+			&rev.PostID,
+			&rev.Version,
+			&rev.Title,
+			&rev.Content,
+			&rev.EditedBy,
+			&rev.EditedAt,
+		); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// createPostRevision records the title and content of a post before editing
+// it to the next version.
+func createPostRevision(ctx context.Context, tx *sql.Tx, rev *PostRevision) error {
+	query := `
+		INSERT INTO post_revisions (post_id, version, title, content, edited_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		rev.PostID,
+		rev.Version,
+		rev.Title,
+		rev.Content,
+		rev.EditedBy,
+	).Scan(&rev.EditedAt)
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type RevokedTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RevokedTokenStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expiry)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, jti, userID, expiry)
+	return err
+}
+
+// RevokeAll revokes every token of the user issued before the given time.
+func (s *RevokedTokenStore) RevokeAll(ctx context.Context, userID int64, before time.Time) error {
+	query := `UPDATE users SET tokens_revoked_at = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, before, userID)
+	return err
+}
+
+// DeleteExpired removes the revocations of tokens that expired on their own
+// since, and returns how many were removed.
+func (s *RevokedTokenStore) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM revoked_tokens WHERE expiry <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *RevokedTokenStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1) OR
+			EXISTS (SELECT 1 FROM users WHERE id = $2 AND tokens_revoked_at > $3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revoked bool
+	if err := s.db.QueryRowContext(ctx, query, jti, userID, issuedAt).Scan(&revoked); err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+// UserSearchResult is a user matching a search, with whether the searching
+// user follows them.
+type UserSearchResult struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	YouFollow   bool   `json:"you_follow"`
+}
+
+// escapes the LIKE wildcards of user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Search finds active users by username or display name. Exact usernames
+// come first, then prefixes of either, then similar names; within each the
+// users viewerID follows come first. Users blocking each other are left out.
+func (s *UserStore) Search(ctx context.Context, viewerID int64, sq UserSearchQuery) ([]UserSearchResult, error) {
+	query := `
+		SELECT id, username, display_name, avatar_url, you_follow
+		FROM (
+			SELECT u.id, u.username, u.display_name, u.avatar_url, u.followers_count,
+				EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $2) AS you_follow,
+				CASE
+					WHEN lower(u.username) = $1 THEN 2
+					WHEN lower(u.username) LIKE $3 OR lower(u.display_name) LIKE $3 THEN 1
+					ELSE 0
+				END AS match,
+				GREATEST(similarity(lower(u.username), $1), similarity(lower(u.display_name), $1)) AS similarity
+			FROM users u
+			WHERE u.is_active = true AND u.is_tombstone = false
+				AND (
+					lower(u.username) LIKE $3 OR lower(u.display_name) LIKE $3
+					OR lower(u.username) % $1 OR lower(u.display_name) % $1
+				)
+				AND NOT EXISTS (
+					SELECT 1 FROM user_blocks b
+					WHERE (b.blocker_id = $2 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $2)
+				)
+		) matches
+		ORDER BY match DESC, you_follow DESC, similarity DESC, followers_count DESC, id
+		LIMIT $4 OFFSET $5
+	`
+
+	q := strings.ToLower(sq.Query)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q, viewerID, likeEscaper.Replace(q)+"%", sq.Limit, sq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserSearchResult{}
+	for rows.Next() {
+		var u UserSearchResult
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL, &u.YouFollow); err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
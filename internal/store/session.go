@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Session struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Expiry    string `json:"expiry"`
+	Revoked   bool   `json:"revoked"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *Session, token string, exp time.Duration) error {
+	query := `
+		INSERT INTO sessions (user_id, token, expiry)
+		VALUES ($1, $2, $3)
+		RETURNING id, expiry, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		session.UserID,
+		hashToken(token),
+		time.Now().Add(exp),
+	).Scan(
+		&session.ID,
+		&session.Expiry,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rotate swaps the refresh token of the session owning oldToken for newToken
+// and extends its expiry. Presenting a token that was already rotated out
+// revokes the whole session and returns ErrTokenReused.
+func (s *SessionStore) Rotate(ctx context.Context, oldToken, newToken string, exp time.Duration) (*Session, error) {
+	var session *Session
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+
+		session, err = s.getByToken(ctx, tx, oldToken)
+		if err != nil {
+			return err
+		}
+
+		if err := s.addRotatedToken(ctx, tx, session.ID, oldToken); err != nil {
+			return err
+		}
+
+		return s.updateToken(ctx, tx, session, newToken, exp)
+	})
+	if errors.Is(err, ErrNotFound) {
+		// the token may have been rotated out already, which means it leaked
+		if err := s.revokeRotated(ctx, oldToken); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *SessionStore) Revoke(ctx context.Context, token string) error {
+	query := `
+		UPDATE sessions SET revoked = true, updated_at = NOW()
+		WHERE token = $1 AND revoked = false
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affectedRows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SessionStore) RevokeAll(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE sessions SET revoked = true, updated_at = NOW()
+		WHERE user_id = $1 AND revoked = false
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (s *SessionStore) getByToken(ctx context.Context, tx *sql.Tx, token string) (*Session, error) {
+	query := `
+		SELECT id, user_id, expiry, revoked, created_at, updated_at
+		FROM sessions
+		WHERE token = $1 AND revoked = false AND expiry > $2
+		FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	session := &Session{}
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Expiry,
+		&session.Revoked,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+func (s *SessionStore) addRotatedToken(ctx context.Context, tx *sql.Tx, sessionID int64, token string) error {
+	query := `INSERT INTO session_rotated_tokens (token, session_id) VALUES ($1, $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, hashToken(token), sessionID)
+	return err
+}
+
+func (s *SessionStore) updateToken(ctx context.Context, tx *sql.Tx, session *Session, token string, exp time.Duration) error {
+	query := `
+		UPDATE sessions SET token = $1, expiry = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING expiry, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(ctx, query, hashToken(token), time.Now().Add(exp), session.ID).Scan(
+		&session.Expiry,
+		&session.UpdatedAt,
+	)
+}
+
+// revokeRotated revokes the session an already rotated token belonged to.
+func (s *SessionStore) revokeRotated(ctx context.Context, token string) error {
+	query := `
+		UPDATE sessions SET revoked = true, updated_at = NOW()
+		WHERE id = (SELECT session_id FROM session_rotated_tokens WHERE token = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affectedRows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -2,7 +2,9 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"time"
 )
@@ -12,6 +14,11 @@ var (
 	ErrConflict          = errors.New("already exists")
 	ErrDuplicateEmail    = errors.New("email already exists")
 	ErrDuplicateUsername = errors.New("username already exists")
+	ErrTokenReused       = errors.New("refresh token reuse detected")
+	ErrSelfFollow        = errors.New("users cannot follow themselves")
+	ErrNotFollowing      = errors.New("not following the user")
+	ErrSelfBlock         = errors.New("users cannot block themselves")
+	ErrSelfMute          = errors.New("users cannot mute themselves")
 )
 
 const (
@@ -22,38 +29,160 @@ type Storage struct {
 	Posts interface {
 		Create(context.Context, *Post) error
 		GetById(context.Context, int64) (*Post, error)
-		Delete(context.Context, int64) error
-		Update(context.Context, *Post) error
+		Delete(context.Context, int64) ([]string, error)
+		Update(ctx context.Context, post *Post, editorID int64) error
 		GetFeed(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetUserPosts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetDrafts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		PublishDue(ctx context.Context, limit int) ([]int64, error)
+	}
+	PostImages interface {
+		GetByPostID(ctx context.Context, postID int64) ([]PostImage, error)
+		ClaimPending(ctx context.Context, limit int, staleAfter time.Duration) ([]PostImage, error)
+		Complete(ctx context.Context, img *PostImage) error
+		Fail(ctx context.Context, img *PostImage, reason string) error
+	}
+	PostRevisions interface {
+		GetByPostID(ctx context.Context, postID int64) ([]PostRevision, error)
+	}
+	Attachments interface {
+		GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Attachment, error)
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostId(context.Context, int64) ([]Comment, error)
+		GetByPostId(ctx context.Context, postID, viewerID int64) ([]Comment, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
+		Search(ctx context.Context, viewerID int64, sq UserSearchQuery) ([]UserSearchResult, error)
 		CreateAndInvite(context.Context, *User, string, time.Duration) error
+		CreateWithIdentity(context.Context, *User, *Identity) error
 		GetById(context.Context, int64) (*User, error)
 		GetByEmail(context.Context, string) (*User, error)
 		Activate(context.Context, string) error
 		Delete(context.Context, int64) error
+		DeleteAccount(ctx context.Context, userID int64, mode string) ([]string, error)
+		Reinvite(ctx context.Context, email string, token string, exp time.Duration) (*User, error)
+		DeleteExpiredInvitations(ctx context.Context) (int64, error)
+		DeleteInactive(ctx context.Context, gracePeriod time.Duration) (int64, error)
+		CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error
+		ResetPassword(ctx context.Context, token string, newPassword string) (*User, error)
+		Update(ctx context.Context, user *User) ([]int64, error)
+		CreateEmailChange(ctx context.Context, userID int64, newEmail string, token string, exp time.Duration) error
+		ConfirmEmailChange(ctx context.Context, token string) (*User, error)
 	}
 	Followers interface {
-		Follow(ctx context.Context, followerId int64, userId int64) error
+		Follow(ctx context.Context, followerId int64, userId int64) (bool, error)
 		Unfollow(ctx context.Context, followerId int64, userId int64) error
+		GetFollowRequests(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*FollowRequestPage, error)
+		ApproveFollowRequest(ctx context.Context, userID, requesterID int64) error
+		RejectFollowRequest(ctx context.Context, userID, requesterID int64) error
+		CanSeePosts(ctx context.Context, userID, viewerID int64) (bool, error)
+		GetFollowers(ctx context.Context, userID, viewerID int64, fq PaginatedFollowQuery) (*FollowPage, error)
+		GetFollowing(ctx context.Context, userID, viewerID int64, fq PaginatedFollowQuery) (*FollowPage, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID, blockedID int64) error
+		Unblock(ctx context.Context, blockerID, blockedID int64) error
+		GetBlocked(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*RestrictedUserPage, error)
+		IsBlocked(ctx context.Context, userID, otherID int64) (bool, error)
+	}
+	Mutes interface {
+		Mute(ctx context.Context, muterID, mutedID int64) error
+		Unmute(ctx context.Context, muterID, mutedID int64) error
+		GetMuted(ctx context.Context, userID int64, fq PaginatedFollowQuery) (*RestrictedUserPage, error)
+	}
+	Suggestions interface {
+		GetSuggestions(ctx context.Context, userID int64, limit int) ([]Suggestion, error)
 	}
 	Roles interface {
 		GetByName(ctx context.Context, slug RoleKeys) (*Role, error)
 	}
+	Sessions interface {
+		Create(ctx context.Context, session *Session, token string, exp time.Duration) error
+		Rotate(ctx context.Context, oldToken, newToken string, exp time.Duration) (*Session, error)
+		Revoke(ctx context.Context, token string) error
+		RevokeAll(ctx context.Context, userID int64) error
+	}
+	MFA interface {
+		GetByUserID(ctx context.Context, userID int64) (*UserMFA, error)
+		SetSecret(ctx context.Context, userID int64, secret []byte) error
+		Enable(ctx context.Context, userID int64, step int64, recoveryCodes []string) error
+		Disable(ctx context.Context, userID int64) error
+		UseStep(ctx context.Context, userID int64, step int64) error
+		UseRecoveryCode(ctx context.Context, userID int64, code string) error
+	}
+	PersonalTokens interface {
+		Create(ctx context.Context, pat *PersonalAccessToken, token string, expiry time.Time) error
+		GetByUserID(ctx context.Context, userID int64) ([]PersonalAccessToken, error)
+		Authenticate(ctx context.Context, token string) (*PersonalAccessToken, error)
+		Delete(ctx context.Context, userID int64, tokenID int64) error
+		DeleteAll(ctx context.Context, userID int64) error
+	}
+	Identities interface {
+		GetUser(ctx context.Context, provider, subject string) (*User, error)
+		Link(ctx context.Context, identity *Identity) error
+		CreateLinkRequest(ctx context.Context, identity *Identity, token string, exp time.Duration) error
+		ConfirmLink(ctx context.Context, token string) (*Identity, error)
+		CreateLoginState(ctx context.Context, state string, loginState *LoginState, exp time.Duration) error
+		ConsumeLoginState(ctx context.Context, provider, state string) (*LoginState, error)
+		DeleteExpired(ctx context.Context) (int64, error)
+	}
+	Uploads interface {
+		Create(ctx context.Context, upload *Upload) error
+		GetByID(ctx context.Context, id string) (*Upload, error)
+		Delete(ctx context.Context, userID int64, id string) (string, error)
+	}
+	DataExports interface {
+		Create(ctx context.Context, export *DataExport, exp time.Duration) error
+		ClaimPending(ctx context.Context, limit int, staleAfter time.Duration) ([]DataExport, error)
+		Complete(ctx context.Context, export *DataExport, token string) error
+		Fail(ctx context.Context, export *DataExport, reason string) error
+		GetByToken(ctx context.Context, token string) (*DataExport, error)
+		DeleteExpired(ctx context.Context) ([]string, error)
+		UserData(ctx context.Context, userID int64) (*UserData, error)
+	}
+	AccountDeletions interface {
+		Schedule(ctx context.Context, deletion *AccountDeletion, gracePeriod time.Duration) error
+		Get(ctx context.Context, userID int64) (*AccountDeletion, error)
+		Cancel(ctx context.Context, userID int64) error
+		Due(ctx context.Context, limit int) ([]AccountDeletion, error)
+	}
+	Lockouts interface {
+		Get(ctx context.Context, userID int64) (*AccountLockout, error)
+		RecordFailure(ctx context.Context, userID int64, policy LockoutPolicy) (*AccountLockout, error)
+		Reset(ctx context.Context, userID int64) error
+	}
+	RevokedTokens interface {
+		Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error
+		RevokeAll(ctx context.Context, userID int64, before time.Time) error
+		IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error)
+		DeleteExpired(ctx context.Context) (int64, error)
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db},
-		Comments:  &CommentStore{db},
-		Users:     &UserStore{db},
-		Followers: &FollowerStore{db},
-		Roles:     &RoleStore{db},
+		Posts:            &PostStore{db},
+		PostImages:       &PostImageStore{db},
+		PostRevisions:    &PostRevisionStore{db},
+		Attachments:      &AttachmentStore{db},
+		Comments:         &CommentStore{db},
+		Users:            &UserStore{db},
+		Followers:        &FollowerStore{db},
+		Blocks:           &BlockStore{db},
+		Mutes:            &MuteStore{db},
+		Suggestions:      &SuggestionStore{db},
+		Roles:            &RoleStore{db},
+		Sessions:         &SessionStore{db},
+		RevokedTokens:    &RevokedTokenStore{db},
+		MFA:              &MFAStore{db},
+		PersonalTokens:   &PersonalTokenStore{db},
+		Identities:       &IdentityStore{db},
+		Lockouts:         &LockoutStore{db},
+		Uploads:          &UploadStore{db},
+		DataExports:      &DataExportStore{db},
+		AccountDeletions: &AccountDeletionStore{db},
 	}
 }
 
@@ -71,3 +200,9 @@ func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
 
 	return tx.Commit()
 }
+
+// hashToken hashes an opaque token so only its digest is ever persisted.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
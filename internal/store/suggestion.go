@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Suggestion is a user the current user may want to follow, with the signals
+// it was ranked by.
+type Suggestion struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	// followed by this many of the users the current user follows
+	MutualFollows int64 `json:"mutual_follows"`
+	// tags of the user's posts also used by the current user
+	SharedTags int64   `json:"shared_tags"`
+	Followers  int64   `json:"followers"`
+	Score      float64 `json:"score"`
+}
+
+// popular users always ranked, so users following nobody get suggestions too
+const popularCandidates = 100
+
+type SuggestionStore struct {
+	db *sql.DB
+}
+
+// GetSuggestions ranks up to limit users for userID to follow. Friends of
+// friends weigh the most, then the tags shared with the posts of userID, then
+// the popularity. Followed, requested, blocked and muted users are excluded,
+// and only the posts of public accounts are matched by tags.
+func (s *SuggestionStore) GetSuggestions(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	query := `
+		WITH following AS (
+			SELECT user_id FROM followers WHERE follower_id = $1
+		), own_tags AS (
+			SELECT COALESCE(array_agg(DISTINCT t.tag), '{}') AS tags
+			FROM posts p, unnest(p.tags) t(tag)
+			WHERE p.user_id = $1
+		), friends_of_friends AS (
+			SELECT f.user_id, COUNT(*) AS mutual
+			FROM followers f
+			JOIN following ON following.user_id = f.follower_id
+			GROUP BY f.user_id
+		), tagged AS (
+			SELECT p.user_id, COUNT(DISTINCT t.tag) AS shared
+			FROM posts p
+			JOIN users a ON a.id = p.user_id, unnest(p.tags) t(tag), own_tags o
+			WHERE p.status = 'published' AND a.is_private = false
+				AND p.tags && o.tags AND t.tag = ANY (o.tags)
+			GROUP BY p.user_id
+		), candidates AS (
+			SELECT user_id FROM friends_of_friends
+			UNION
+			SELECT user_id FROM tagged
+			UNION
+			(
+				SELECT id FROM users
+				WHERE is_active = true AND is_tombstone = false
+				ORDER BY followers_count DESC
+				LIMIT $3
+			)
+		)
+		SELECT u.id, u.username, u.display_name, u.avatar_url,
+			COALESCE(fof.mutual, 0), COALESCE(t.shared, 0), u.followers_count,
+			COALESCE(fof.mutual, 0) * 3 + COALESCE(t.shared, 0) * 2 + ln(1 + u.followers_count) AS score
+		FROM candidates c
+		JOIN users u ON u.id = c.user_id
+		LEFT JOIN friends_of_friends fof ON fof.user_id = u.id
+		LEFT JOIN tagged t ON t.user_id = u.id
+		WHERE u.id <> $1 AND u.is_active = true AND u.is_tombstone = false
+			AND NOT EXISTS (SELECT 1 FROM following WHERE following.user_id = u.id)
+			AND NOT EXISTS (SELECT 1 FROM follow_requests r WHERE r.user_id = u.id AND r.requester_id = $1)
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+			)
+			AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = u.id)
+		ORDER BY score DESC, u.id
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit, popularCandidates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var sg Suggestion
+		if err := rows.Scan(
+			&sg.ID,
+			&sg.Username,
+			&sg.DisplayName,
+			&sg.AvatarURL,
+			&sg.MutualFollows,
+			&sg.SharedTags,
+			&sg.Followers,
+			&sg.Score,
+		); err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, sg)
+	}
+
+	return suggestions, rows.Err()
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	UploadKindAvatar     = "avatar"
+	UploadKindAttachment = "attachment"
+)
+
+// Upload is a file stored in the blob storage under Key.
+type Upload struct {
+	ID          string `json:"id"`
+	UserID      int64  `json:"user_id"`
+	Kind        string `json:"kind"`
+	Key         string `json:"-"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	CreatedAt   string `json:"created_at"`
+	// signed download URL, set when the upload is returned to a client
+	URL string `json:"url,omitempty"`
+}
+
+type UploadStore struct {
+	db *sql.DB
+}
+
+func (s *UploadStore) Create(ctx context.Context, upload *Upload) error {
+	query := `
+		INSERT INTO uploads (id, user_id, kind, key, content_type, size)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		upload.ID,
+		upload.UserID,
+		upload.Kind,
+		upload.Key,
+		upload.ContentType,
+		upload.Size,
+	).Scan(&upload.CreatedAt)
+}
+
+func (s *UploadStore) GetByID(ctx context.Context, id string) (*Upload, error) {
+	query := `
+		SELECT id, user_id, kind, key, content_type, size, created_at
+		FROM uploads
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	upload := &Upload{}
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&upload.ID,
+		&upload.UserID,
+		&upload.Kind,
+		&upload.Key,
+		&upload.ContentType,
+		&upload.Size,
+		&upload.CreatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return upload, nil
+}
+
+// Delete removes an upload of the user and returns the key of its blob for
+// the caller to delete.
+func (s *UploadStore) Delete(ctx context.Context, userID int64, id string) (string, error) {
+	query := `DELETE FROM uploads WHERE id = $1 AND user_id = $2 RETURNING key`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var key string
+	err := s.db.QueryRowContext(ctx, query, id, userID).Scan(&key)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return key, nil
+}
@@ -2,9 +2,7 @@ package store
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -19,6 +17,48 @@ type User struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+	Version   int      `json:"version"`
+	// only followers see the posts of a private account
+	IsPrivate bool `json:"is_private"`
+	UserProfile
+	Stats UserStats `json:"stats"`
+}
+
+// UserProfile holds the details users choose to show on their profile page.
+type UserProfile struct {
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Location    string `json:"location"`
+	Website     string `json:"website"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+type UserStats struct {
+	Followers int64 `json:"followers"`
+	Following int64 `json:"following"`
+	Posts     int64 `json:"posts"`
+}
+
+// PublicUser is what other users see of an account. It never includes the
+// email.
+type PublicUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+	IsPrivate bool   `json:"is_private"`
+	UserProfile
+	Stats UserStats `json:"stats"`
+}
+
+func (u *User) Public() *PublicUser {
+	return &PublicUser{
+		ID:          u.ID,
+		Username:    u.Username,
+		CreatedAt:   u.CreatedAt,
+		IsPrivate:   u.IsPrivate,
+		UserProfile: u.UserProfile,
+		Stats:       u.Stats,
+	}
 }
 
 type password struct {
@@ -89,6 +129,10 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) Delete(ctx context.Context, userID int64) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := releaseFollows(ctx, tx, userID); err != nil {
+			return err
+		}
+
 		if err := s.delete(ctx, tx, userID); err != nil {
 			return err
 		}
@@ -101,9 +145,121 @@ func (s *UserStore) Delete(ctx context.Context, userID int64) error {
 	})
 }
 
+// DeleteAccount removes a user with everything they own. Depending on mode
+// their posts and comments are deleted or reassigned to the tombstone user.
+// The keys of the blobs no longer referenced are returned for the caller to
+// delete. The due deletion requested with mode is claimed first; ErrNotFound
+// is returned when it is carried out by another sweep, was cancelled or was
+// requested again.
+func (s *UserStore) DeleteAccount(ctx context.Context, userID int64, mode string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, accountDeletionTimeout)
+	defer cancel()
+
+	var keys []string
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		claimQuery := `
+			SELECT user_id FROM account_deletions
+			WHERE user_id = $1 AND mode = $2 AND scheduled_at <= NOW()
+			FOR UPDATE SKIP LOCKED
+		`
+
+		if err := tx.QueryRowContext(ctx, claimQuery, userID, mode).Scan(&userID); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		keysQuery := `
+			SELECT key FROM uploads WHERE user_id = $1
+			UNION ALL
+			SELECT key FROM data_exports WHERE user_id = $1 AND key <> ''
+		`
+
+		if mode == DeletionModeDelete {
+			// images are locked so one completing concurrently sees its post
+			// deleted and removes its own variants
+			keysQuery += `
+				UNION ALL
+				SELECT a.key FROM attachments a JOIN posts p ON p.id = a.post_id WHERE p.user_id = $1
+				UNION ALL
+				SELECT v.value
+				FROM (
+					SELECT i.variants FROM post_images i JOIN posts p ON p.id = i.post_id
+					WHERE p.user_id = $1
+					FOR UPDATE OF i
+				) i,
+					jsonb_each_text(i.variants) v
+			`
+		}
+
+		rows, err := tx.QueryContext(ctx, keysQuery, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		var queries []string
+		switch mode {
+		case DeletionModeAnonymize:
+			queries = []string{
+				`UPDATE posts SET user_id = (SELECT id FROM users WHERE is_tombstone) WHERE user_id = $1`,
+				`UPDATE post_images SET user_id = (SELECT id FROM users WHERE is_tombstone) WHERE user_id = $1`,
+				`UPDATE comments SET user_id = (SELECT id FROM users WHERE is_tombstone) WHERE user_id = $1`,
+			}
+		default:
+			// comments on the posts go with them
+			queries = []string{
+				`DELETE FROM comments WHERE user_id = $1`,
+				`DELETE FROM posts WHERE user_id = $1`,
+			}
+		}
+
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return err
+			}
+		}
+
+		if err := s.deleteUserInvitations(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		if err := releaseFollows(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		// everything else owned by the user is removed by cascade
+		return s.delete(ctx, tx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
 func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, roles.*
+		SELECT u.id, u.username, u.email, u.created_at, u.version, u.is_private,
+			u.display_name, u.bio, u.location, u.website, u.avatar_url,
+			u.followers_count, u.following_count, u.posts_count,
+			roles.*
 		FROM users u
 		JOIN roles ON u.role_id = roles.id
 		WHERE u.id = $1 AND u.is_active = true
@@ -116,6 +272,17 @@ func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 		&user.ID,
 		&user.Username,
 		&user.Email,
+		&user.CreatedAt,
+		&user.Version,
+		&user.IsPrivate,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Location,
+		&user.Website,
+		&user.AvatarURL,
+		&user.Stats.Followers,
+		&user.Stats.Following,
+		&user.Stats.Posts,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Level,
@@ -172,6 +339,25 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 	})
 }
 
+// CreateWithIdentity creates an already active user signing up through an
+// external provider and links the provider identity to it.
+func (s *UserStore) CreateWithIdentity(ctx context.Context, user *User, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.Create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		// the provider verified the email already
+		user.IsActive = true
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return createIdentity(ctx, tx, identity)
+	})
+}
+
 func (s *UserStore) Activate(ctx context.Context, token string) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		// 1. find the user that this token belongs to
@@ -195,6 +381,275 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 	})
 }
 
+// Reinvite replaces the invitations of a not yet activated user with a fresh
+// one and returns that user.
+func (s *UserStore) Reinvite(ctx context.Context, email string, token string, inviteExpiration time.Duration) (*User, error) {
+	var user *User
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+
+		user, err = s.getInactiveByEmail(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+
+		if err := s.deleteUserInvitations(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		return s.createUserInvitation(ctx, tx, hashToken(token), inviteExpiration, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `DELETE FROM user_invitations WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteInactive removes accounts that were never activated and were created
+// more than gracePeriod ago. The tombstone user, inactive by design, is kept.
+func (s *UserStore) DeleteInactive(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	var deleted int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		createdBefore := time.Now().Add(-gracePeriod)
+
+		query := `
+			DELETE FROM user_invitations
+			WHERE user_id IN (
+				SELECT id FROM users WHERE is_active = false AND is_tombstone = false AND created_at < $1
+			)
+		`
+		if _, err := tx.ExecContext(ctx, query, createdBefore); err != nil {
+			return err
+		}
+
+		query = `DELETE FROM users WHERE is_active = false AND is_tombstone = false AND created_at < $1`
+		res, err := tx.ExecContext(ctx, query, createdBefore)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// only the latest reset link stays valid
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO password_resets (user_id, token, expiry)
+			VALUES ($1, $2, $3)
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, userID, hashToken(token), time.Now().Add(exp))
+		return err
+	})
+}
+
+func (s *UserStore) ResetPassword(ctx context.Context, token string, newPassword string) (*User, error) {
+	var user *User
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+
+		// 1. find the user that this token belongs to, locking the token so a
+		// concurrent reset with the same link waits and then finds it gone
+		user, err = s.getUserFromPasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		// 2. update the password
+		if err := user.Password.Set(newPassword); err != nil {
+			return err
+		}
+
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+
+		// 3. clean the reset tokens
+		return s.deletePasswordResets(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Update saves the username, the profile, and the password when one was set,
+// of a user at the version it was read. It returns ErrNotFound when the user
+// changed in the meantime. The pending follow requests of a public account
+// are approved, and the requesters now following it are returned.
+func (s *UserStore) Update(ctx context.Context, user *User) ([]int64, error) {
+	query := `
+		UPDATE users
+		SET username = $1, password = COALESCE($2, password),
+			display_name = $5, bio = $6, location = $7, website = $8, avatar_url = $9,
+			is_private = $10, version = version + 1, updated_at = NOW()
+		WHERE id = $3 AND version = $4
+		RETURNING version
+	`
+
+	// a nil interface is sent as NULL, unlike an empty hash
+	var hash any
+	if user.Password.hash != nil {
+		hash = user.Password.hash
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var approved []int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			user.Username,
+			hash,
+			user.ID,
+			user.Version,
+			user.DisplayName,
+			user.Bio,
+			user.Location,
+			user.Website,
+			user.AvatarURL,
+			user.IsPrivate,
+		).Scan(&user.Version)
+		if err != nil {
+			switch {
+			case err == sql.ErrNoRows:
+				return ErrNotFound
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+				return ErrDuplicateUsername
+			default:
+				return err
+			}
+		}
+
+		if !user.IsPrivate {
+			approved, err = approveFollowRequests(ctx, tx, user.ID)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return approved, nil
+}
+
+// CreateEmailChange stores a pending change to newEmail, confirmed with the
+// token sent to that address.
+func (s *UserStore) CreateEmailChange(ctx context.Context, userID int64, newEmail string, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// only the latest requested address can be confirmed
+		if err := s.deleteEmailChanges(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO email_changes (user_id, new_email, token, expiry)
+			VALUES ($1, $2, $3, $4)
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, userID, newEmail, hashToken(token), time.Now().Add(exp))
+		return err
+	})
+}
+
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	user := &User{}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// 1. find the pending change of this token
+		query := `
+			SELECT user_id, new_email
+			FROM email_changes
+			WHERE token = $1 AND expiry > $2
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(&user.ID, &user.Email)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		// 2. update the email
+		query = `
+			UPDATE users SET email = $1, version = version + 1, updated_at = NOW()
+			WHERE id = $2
+			RETURNING username, version
+		`
+
+		err = tx.QueryRowContext(ctx, query, user.Email, user.ID).Scan(&user.Username, &user.Version)
+		if err != nil {
+			switch {
+			case err == sql.ErrNoRows:
+				return ErrNotFound
+			case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+				return ErrDuplicateEmail
+			default:
+				return err
+			}
+		}
+
+		// 3. clean the pending changes
+		return s.deleteEmailChanges(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
 func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, inviteExpiration time.Duration, userId int64) error {
 	query := `
 		INSERT INTO user_invitations (user_id, token, expiry)
@@ -220,14 +675,11 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token
 		WHERE ui.token = $1 AND ui.expiry > $2
 	`
 
-	hash := sha256.Sum256([]byte(token))
-	hashToken := hex.EncodeToString(hash[:])
-
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	user := &User{}
-	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -287,3 +739,95 @@ func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userI
 
 	return nil
 }
+
+func (s *UserStore) getInactiveByEmail(ctx context.Context, tx *sql.Tx, email string) (*User, error) {
+	query := `
+		SELECT id, username, email, created_at, is_active
+		FROM users
+		WHERE email = $1 AND is_active = false
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) getUserFromPasswordReset(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active
+		FROM users u
+		JOIN password_resets pr ON u.id = pr.user_id
+		WHERE pr.token = $1 AND pr.expiry > $2
+		FOR UPDATE OF pr
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID)
+	return err
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (s *UserStore) deleteEmailChanges(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM email_changes WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
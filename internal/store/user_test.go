@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResetPassword(t *testing.T) {
+	db := newTestDB(t)
+	s := &UserStore{db}
+	ctx := context.Background()
+
+	var userID int64
+	err := db.QueryRow(`
+		INSERT INTO users (email, username, password, is_active)
+		VALUES ('reset@example.com', 'reset', '', true)
+		RETURNING id
+	`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CreatePasswordReset(ctx, userID, "token", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// a reset with the same link holds the token until it commits
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT 1 FROM password_resets WHERE token = $1 FOR UPDATE`, hashToken("token")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.ResetPassword(ctx, "token", "new-password")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected the reset to wait for the token, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := tx.Exec(`DELETE FROM password_resets WHERE user_id = $1`, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != ErrNotFound {
+		t.Errorf("expected the used token to be rejected, got %v", err)
+	}
+}
+
+func TestDeleteInactive(t *testing.T) {
+	db := newTestDB(t)
+	s := &UserStore{db}
+	ctx := context.Background()
+
+	_, err := db.Exec(`
+		INSERT INTO users (email, username, password, is_active, created_at)
+		VALUES ('inactive@example.com', 'inactive', '', false, NOW() - interval '2 days')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tombstone is as old as the migrations
+	if _, err := db.Exec(`UPDATE users SET created_at = NOW() - interval '2 days' WHERE is_tombstone`); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := s.DeleteInactive(ctx, time.Hour*24)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 1 {
+		t.Errorf("expected 1 inactive user to be deleted, got %d", deleted)
+	}
+
+	var tombstones int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE is_tombstone`).Scan(&tombstones); err != nil {
+		t.Fatal(err)
+	}
+
+	if tombstones != 1 {
+		t.Error("expected the tombstone user to be kept")
+	}
+}
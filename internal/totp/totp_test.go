@@ -0,0 +1,85 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// test vectors from RFC 6238 appendix B, truncated to six digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != tt.code {
+			t.Errorf("at %d expected %s; got %s", tt.unix, tt.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := Code(secret, Step(now.Add(-Period*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should accept a code within the skew", func(t *testing.T) {
+		step, ok := Validate(secret, code, now, 1)
+		if !ok {
+			t.Fatal("expected the code to be valid")
+		}
+
+		if step != Step(now)-1 {
+			t.Errorf("expected step %d; got %d", Step(now)-1, step)
+		}
+	})
+
+	t.Run("should reject a code outside the skew", func(t *testing.T) {
+		if _, ok := Validate(secret, code, now, 0); ok {
+			t.Error("expected the code to be rejected")
+		}
+	})
+}
+
+func TestCipher(t *testing.T) {
+	c, err := NewCipher("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := c.Encrypt("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := c.Decrypt(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decrypted != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("expected the original secret; got %s", decrypted)
+	}
+}